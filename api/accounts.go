@@ -0,0 +1,244 @@
+package api
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/db"
+)
+
+// changing a password, name or deleting an account ends all of the user's sessions;
+// when users do this to their own account, they get a fresh session
+// renaming or deleting an account also revokes its api tokens
+
+// check that name can be taken by a registered user
+func checkNewName(name string) error {
+	if err := db.ValidateUserName(name); err != nil {
+		return err
+	}
+	if isGuestName(name) {
+		return fiber.NewError(fiber.StatusBadRequest, "Names starting with "+GUEST_PREFIX+" are reserved for guests")
+	}
+	return nil
+}
+
+// held while a registered user takes a seat, and while a user is renamed,
+// so that nobody can sit down under a name that's being changed
+var seatLocks = makeKeyLocks()
+
+// whether name is seated in any live lobby, auction, game or match
+func isPlaying(name string) bool {
+	return lobbyManager.HasPlayer(name) ||
+		bidManager.HasPlayer(name) ||
+		gameManager.HasPlayer(name) ||
+		matchManager.HasPlayer(name)
+}
+
+func setPassword(name string, password string) error {
+	if _, err := storage.GetUser(name); err != nil {
+		return err
+	}
+	if err := db.ValidatePassword(password); err != nil {
+		return err
+	}
+	hash, err := db.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := storage.UpdateUser(name, map[string]interface{}{"Password": hash}); err != nil {
+		return err
+	}
+	_, err = revokeUserSessions(name)
+	return err
+}
+
+func renameUser(oldName string, newName string) error {
+	if err := checkNewName(newName); err != nil {
+		return err
+	}
+	// lobbies and games refer to players by name, so renaming would lose the player's seat
+	// the lock is held until the old name's logins are revoked, after which it can't be seated again
+	defer seatLocks.lock(oldName)()
+	if isPlaying(oldName) {
+		return fiber.NewError(fiber.StatusConflict, "Cannot change name while in a lobby or game")
+	}
+	if err := storage.RenameUser(oldName, newName); err != nil {
+		return err
+	}
+	if _, err := revokeUserAPITokens(oldName); err != nil {
+		return err
+	}
+	_, err := revokeUserSessions(oldName)
+	return err
+}
+
+func deleteUser(name string) error {
+	user, err := storage.GetUser(name)
+	if err != nil {
+		return err
+	}
+	if err := storage.DeleteUser(name); err != nil {
+		return err
+	}
+	if user.Identity != "" {
+		if err := storage.DeleteIdentity(user.Identity); err != nil {
+			return err
+		}
+	}
+	if _, err := revokeUserAPITokens(name); err != nil {
+		return err
+	}
+	_, err = revokeUserSessions(name)
+	return err
+}
+
+func sendAccountError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case db.ItemNotFound:
+		c.Context().SetStatusCode(fiber.StatusNotFound)
+		return c.SendString(e.Error())
+	case db.ItemAlreadyExists:
+		c.Context().SetStatusCode(fiber.StatusConflict)
+		return c.SendString("That name is already taken")
+	case db.PasswordTooLong:
+		c.Context().SetStatusCode(fiber.StatusBadRequest)
+		return c.SendString(e.Error())
+	case db.InvalidUserInput:
+		c.Context().SetStatusCode(fiber.StatusBadRequest)
+		return c.SendString(e.Error())
+	case TooManyAttempts:
+		return sendTooManyAttempts(c, e)
+	case *fiber.Error:
+		c.Context().SetStatusCode(e.Code)
+		return c.SendString(e.Message)
+	default:
+		log.Println("When updating account:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+// check that the request comes from a registered user who knows their password
+func checkOwnAccount(c *fiber.Ctx, password string) (JWTPayload, error) {
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return authInfo, fiber.ErrUnauthorized
+	}
+	if authInfo.Guest {
+		return authInfo, fiber.NewError(fiber.StatusBadRequest, "Guests don't have an account; claim one first")
+	}
+	user, err := storage.GetUser(authInfo.Name)
+	if err != nil {
+		return authInfo, err
+	}
+	if user.Password == "" {
+		return authInfo, fiber.NewError(fiber.StatusBadRequest, "This account signs in with an identity provider, so it has no password")
+	}
+	ok, _, err := checkLogin(c, authInfo.Name, password)
+	if err != nil {
+		return authInfo, err
+	}
+	if !ok {
+		return authInfo, fiber.NewError(fiber.StatusUnauthorized, "Incorrect password")
+	}
+	return authInfo, nil
+}
+
+// start a new session for name, after its old ones have been revoked
+func restartSession(c *fiber.Ctx, name string) error {
+	user, err := storage.GetUser(name)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	userInfo, err := startSession(c, user)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	return c.JSON(userInfo)
+}
+
+func changePasswordHandler(c *fiber.Ctx) error {
+	input := struct {
+		OldPassword string `json:"oldPassword"`
+		NewPassword string `json:"newPassword"`
+	}{}
+	if err := c.BodyParser(&input); err != nil || input.NewPassword == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	authInfo, err := checkOwnAccount(c, input.OldPassword)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	if err := setPassword(authInfo.Name, input.NewPassword); err != nil {
+		return sendAccountError(c, err)
+	}
+	return restartSession(c, authInfo.Name)
+}
+
+func changeNameHandler(c *fiber.Ctx) error {
+	input := struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}{}
+	if err := c.BodyParser(&input); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	authInfo, err := checkOwnAccount(c, input.Password)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	if err := renameUser(authInfo.Name, input.Name); err != nil {
+		return sendAccountError(c, err)
+	}
+	return restartSession(c, input.Name)
+}
+
+func deleteAccountHandler(c *fiber.Ctx) error {
+	input := struct {
+		Password string `json:"password"`
+	}{}
+	if err := c.BodyParser(&input); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	authInfo, err := checkOwnAccount(c, input.Password)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	if err := deleteUser(authInfo.Name); err != nil {
+		return sendAccountError(c, err)
+	}
+	ClearTokenCookie(c)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func adminSetPasswordHandler(c *fiber.Ctx) error {
+	input := struct {
+		Password string `json:"password"`
+	}{}
+	if err := c.BodyParser(&input); err != nil || input.Password == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := setPassword(c.Params("name"), input.Password); err != nil {
+		return sendAccountError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func adminRenameHandler(c *fiber.Ctx) error {
+	input := struct {
+		Name string `json:"name"`
+	}{}
+	if err := c.BodyParser(&input); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := renameUser(c.Params("name"), input.Name); err != nil {
+		return sendAccountError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func adminDeleteUserHandler(c *fiber.Ctx) error {
+	if err := deleteUser(c.Params("name")); err != nil {
+		return sendAccountError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// only lets admins through to the rest of the group
+func requireAdmin(c *fiber.Ctx) error {
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if !authInfo.Admin {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	return c.Next()
+}
+
+// log a user out everywhere, e.g. if their account has been compromised
+func revokeUserSessionsHandler(c *fiber.Ctx) error {
+	revoked, err := revokeUserSessions(c.Params("name"))
+	if err != nil {
+		log.Println("When revoking user's sessions:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{"revoked": revoked})
+}
+
+func setupAdmin(r fiber.Router) {
+	r.Use(requireAdmin)
+	r.Delete("/users/:name/sessions", revokeUserSessionsHandler)
+	r.Delete("/users/:name/tokens", adminRevokeAPITokensHandler)
+	r.Put("/users/:name/password", adminSetPasswordHandler)
+	r.Put("/users/:name/name", adminRenameHandler)
+	r.Delete("/users/:name", adminDeleteUserHandler)
+	r.Get("/audit/logins", loginAuditHandler)
+	r.Get("/bots", listBotsHandler)
+	r.Post("/bots", registerBotHandler)
+	r.Put("/bots/:name", updateBotHandler)
+	r.Delete("/bots/:name", deleteBotHandler)
+}
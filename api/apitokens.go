@@ -0,0 +1,156 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/db"
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// users can make api tokens for bots and scripts, so they don't have to go through the login flow
+// tokens are limited to the scopes they're made with, and can only be managed from a login session
+
+const (
+	// lobbies, bidding, games and matches
+	SCOPE_PLAY = "play"
+	// the admin endpoints; only admins can make tokens with this scope
+	SCOPE_ADMIN = "admin"
+)
+
+var API_TOKEN_SCOPES = []string{SCOPE_PLAY, SCOPE_ADMIN}
+
+const MAX_API_TOKENS = 20
+const MAX_API_TOKEN_NAME_LENGTH = 64
+
+// what clients see of a token; the secret is only shown once, when the token is made
+type apiTokenInfo struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Created int64    `json:"created"`
+	Expires int64    `json:"expires"`
+}
+
+func makeAPITokenInfo(t db.APIToken) apiTokenInfo {
+	return apiTokenInfo{t.ID, t.Name, t.Scopes, t.Created, t.Expires}
+}
+
+// end all of the user's api tokens, e.g. when the account is renamed or deleted
+func revokeUserAPITokens(name string) (int, error) {
+	return db.RevokeUserAPITokens(storage, name)
+}
+
+// the logged-in user, if they can have api tokens
+func apiTokenOwner(c *fiber.Ctx) (JWTPayload, error) {
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return authInfo, fiber.ErrUnauthorized
+	}
+	if authInfo.Guest {
+		return authInfo, fiber.NewError(fiber.StatusBadRequest, "Guests can't make API tokens; claim an account first")
+	}
+	return authInfo, nil
+}
+
+func listAPITokensHandler(c *fiber.Ctx) error {
+	authInfo, err := apiTokenOwner(c)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	tokens, err := storage.UserAPITokens(authInfo.Name)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	infos := make([]apiTokenInfo, len(tokens))
+	for i, t := range tokens {
+		infos[i] = makeAPITokenInfo(t)
+	}
+	return c.JSON(infos)
+}
+
+func createAPITokenHandler(c *fiber.Ctx) error {
+	input := struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// 0 for a token that doesn't expire
+		ExpiresInDays int `json:"expiresInDays"`
+	}{}
+	if err := c.BodyParser(&input); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	authInfo, err := apiTokenOwner(c)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	if input.Name == "" || len(input.Name) > MAX_API_TOKEN_NAME_LENGTH {
+		c.Context().SetStatusCode(fiber.StatusBadRequest)
+		return c.SendString(fmt.Sprintf("Token name must be between 1 and %d characters long", MAX_API_TOKEN_NAME_LENGTH))
+	}
+	if len(input.Scopes) == 0 {
+		input.Scopes = []string{SCOPE_PLAY}
+	}
+	for _, scope := range input.Scopes {
+		if !utils.Contains(API_TOKEN_SCOPES, scope) {
+			c.Context().SetStatusCode(fiber.StatusBadRequest)
+			return c.SendString(fmt.Sprintf("Unknown scope %s; options are %v", scope, API_TOKEN_SCOPES))
+		}
+	}
+	if utils.Contains(input.Scopes, SCOPE_ADMIN) && !authInfo.Admin {
+		c.Context().SetStatusCode(fiber.StatusForbidden)
+		return c.SendString("Only admins can make tokens with the admin scope")
+	}
+	if input.ExpiresInDays < 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	existing, err := storage.UserAPITokens(authInfo.Name)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	if len(existing) >= MAX_API_TOKENS {
+		c.Context().SetStatusCode(fiber.StatusConflict)
+		return c.SendString(fmt.Sprintf("You can't have more than %d API tokens; revoke one first", MAX_API_TOKENS))
+	}
+	lifetime := time.Duration(input.ExpiresInDays) * time.Hour * 24
+	token, secret, err := db.NewAPIToken(authInfo.Name, input.Name, input.Scopes, lifetime)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	if err := storage.PutAPIToken(token); err != nil {
+		return sendAccountError(c, err)
+	}
+	return c.JSON(fiber.Map{
+		"token": secret,
+		"info":  makeAPITokenInfo(token),
+	})
+}
+
+func revokeAPITokenHandler(c *fiber.Ctx) error {
+	authInfo, err := apiTokenOwner(c)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	token, err := storage.GetAPIToken(c.Params("id"))
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	// don't let on that other users' tokens exist
+	if token.User != authInfo.Name {
+		return sendAccountError(c, db.ItemNotFound{ItemName: "API token"})
+	}
+	if err := storage.DeleteAPIToken(token.ID); err != nil {
+		return sendAccountError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func adminRevokeAPITokensHandler(c *fiber.Ctx) error {
+	revoked, err := revokeUserAPITokens(c.Params("name"))
+	if err != nil {
+		log.Println("When revoking user's api tokens:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{"revoked": revoked})
+}
@@ -16,38 +16,70 @@ func loginHandler(c *fiber.Ctx) error {
 	if err := c.BodyParser(&loginInput); err != nil {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	var user db.User
-	if tables == nil {
-		user = db.User{
-			Name:     loginInput.Name,
-			Password: loginInput.Password,
-		}
-	} else {
-		ok, u, err := tables.UserTable.ValidateUser(loginInput.Name, loginInput.Password)
-		if !ok || err != nil {
-			log.Println("When validating login:", err)
-			return c.SendStatus(fiber.StatusUnauthorized)
-		}
-		user = u
+	ok, user, err := checkLogin(c, loginInput.Name, loginInput.Password)
+	if e, limited := err.(TooManyAttempts); limited {
+		return sendTooManyAttempts(c, e)
+	}
+	if !ok || err != nil {
+		log.Println("When validating login:", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 	// login is ok; send jwt token
-	userInfo, err := SetTokenCookie(c, user)
+	userInfo, err := startSession(c, user)
+	if err != nil {
+		log.Println("When starting session at login", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(userInfo)
+}
+
+func refreshHandler(c *fiber.Ctx) error {
+	userInfo, err := refreshSession(c)
 	if err != nil {
-		log.Println("When getting JWT at login", err)
+		if _, ok := err.(InvalidRefreshToken); ok {
+			ClearTokenCookie(c)
+			c.Context().SetStatusCode(fiber.StatusUnauthorized)
+			return c.SendString(err.Error())
+		}
+		log.Println("When refreshing session:", err)
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 	return c.JSON(userInfo)
 }
 
 func logoutHandler(c *fiber.Ctx) error {
+	if session, ok := currentSession(c); ok {
+		if err := revokeSession(session); err != nil {
+			log.Println("When revoking session at logout:", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+	} else if authInfo, err := getAuthInfo(c); err == nil && authInfo.Guest {
+		// guests have no session, so their token has to be turned away until it expires
+		if err := denyToken(authInfo.JTI, authInfo.ExpireTime); err != nil {
+			log.Println("When denying guest token at logout:", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
 	ClearTokenCookie(c)
 	return c.SendStatus(fiber.StatusOK)
 }
 
-func createUserHandler(c *fiber.Ctx) error {
-	if tables == nil {
-		return c.SendStatus(fiber.StatusServiceUnavailable)
+// end every session for the logged-in user, on all devices
+func logoutEverywhereHandler(c *fiber.Ctx) error {
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	revoked, err := revokeUserSessions(authInfo.Name)
+	if err != nil {
+		log.Println("When revoking all sessions:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
 	}
+	ClearTokenCookie(c)
+	return c.JSON(fiber.Map{"revoked": revoked})
+}
+
+func createUserHandler(c *fiber.Ctx) error {
 	type CreateUserInput struct {
 		Name     string `json:"name"`
 		Password string `json:"password"`
@@ -56,28 +88,22 @@ func createUserHandler(c *fiber.Ctx) error {
 	if err := c.BodyParser(&input); err != nil {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	alreadyExists, err := tables.UserExists(input.Name)
-	if err != nil {
-		log.Println("When checking if user exists:", err)
-		return c.SendStatus(fiber.StatusInternalServerError)
-	}
-	if alreadyExists {
-		return c.SendStatus(fiber.StatusConflict)
+	if err := checkNewName(input.Name); err != nil {
+		return sendAccountError(c, err)
 	}
-	err = tables.PutUser(db.User{
-		Name:     input.Name,
-		Password: input.Password,
-		Admin:    false,
-	})
+	user, err := db.NewUser(input.Name, input.Password, false)
 	if err != nil {
-		log.Println("When creating new user on db:", err)
-		return c.SendStatus(fiber.StatusInternalServerError)
+		return sendAccountError(c, err)
+	}
+	// fails if someone else registered the name first, even at the same moment
+	if err := storage.PutUser(user); err != nil {
+		return sendAccountError(c, err)
 	}
 	return c.SendStatus(fiber.StatusAccepted)
 }
 
 func authStatusHandler(c *fiber.Ctx) error {
-	userInfo, err := UnloadTokenCookie(c)
+	userInfo, err := getAuthInfo(c)
 	if err != nil {
 		log.Println("When unloading JWT cookie:", err)
 	}
@@ -86,7 +112,20 @@ func authStatusHandler(c *fiber.Ctx) error {
 
 func setupAuth(r fiber.Router) {
 	r.Post("/login", loginHandler)
+	r.Post("/refresh", refreshHandler)
 	r.Post("/logout", logoutHandler)
+	r.Post("/logout/all", logoutEverywhereHandler)
 	r.Post("/register", createUserHandler)
+	r.Post("/guest", guestLoginHandler)
+	r.Post("/claim", claimGuestHandler)
+	r.Put("/password", changePasswordHandler)
+	r.Put("/name", changeNameHandler)
+	r.Delete("/account", deleteAccountHandler)
 	r.Get("/status", authStatusHandler)
+	r.Get("/oidc", oidcInfoHandler)
+	r.Get("/oidc/login", oidcLoginHandler)
+	r.Get("/oidc/callback", oidcCallbackHandler)
+	r.Get("/tokens", listAPITokensHandler)
+	r.Post("/tokens", createAPITokenHandler)
+	r.Delete("/tokens/:id", revokeAPITokenHandler)
 }
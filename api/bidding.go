@@ -4,14 +4,14 @@ import (
 	"fmt"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 	"github.com/quevivasbien/bird-game/game"
-	"github.com/quevivasbien/bird-game/utils"
 )
 
 var bidManager = MakeManager[game.BidState]()
 
 func startBidding(c *fiber.Ctx) error {
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
@@ -27,16 +27,20 @@ func startBidding(c *fiber.Ctx) error {
 		return c.SendString("You must be the lobby host to start bidding")
 	}
 
+	bidState := game.InitializeBidState(gameID, lobby.Players, 0, lobby.Rules, lobby.Bots)
+	bidState.Spectating = lobby.Spectating
+	if !bidManager.Insert(bidState) {
+		c.Context().SetStatusCode(fiber.StatusConflict)
+		return c.SendString("Bidding has already started for this game")
+	}
 	lobbyManager.Delete(gameID, ContinueCode)
-
-	bidState := game.InitializeBidState(gameID, lobby.Players)
-	bidManager.Put(bidState)
+	startBidBots(gameID)
 
 	return c.SendStatus(fiber.StatusOK)
 }
 
 func getBidState(c *fiber.Ctx) error {
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
@@ -46,29 +50,51 @@ func getBidState(c *fiber.Ctx) error {
 		c.Context().SetStatusCode(fiber.StatusNotFound)
 		return c.SendString("Requested bid state was not found in bid manager")
 	}
-	userIndex := utils.IndexOf(bidState.Players[:], authInfo.Name)
-	if userIndex == -1 {
+	if !canWatch(bidState, authInfo) {
 		c.Context().SetStatusCode(fiber.StatusForbidden)
 		return c.SendString("Tried to get game state for a player not in the game")
 	}
-	return c.JSON(bidState.Visible(userIndex))
+	view, exists := bidManager.View(gameID, authInfo.Name)
+	if !exists {
+		c.Context().SetStatusCode(fiber.StatusTooEarly)
+		return c.SendString("Bid state is not available to spectators yet")
+	}
+	return c.JSON(view)
 }
 
-func submitBid(c *fiber.Ctx) error {
-	gameID := c.Params("gameid")
-	bidState, exists := bidManager.Get(gameID)
-	if !exists {
-		c.Context().SetStatusCode(fiber.StatusNotFound)
-		return c.SendString("Bid state was not found in bid manager")
+// make a bid (or pass, if amount doesn't beat the current bid) for player,
+// starting the game if that ends the auction
+func placeBid(player string, gameID string, amount int) error {
+	var bidState game.BidState
+	err := bidManager.Update(gameID, func(b *game.BidState) error {
+		if !b.HasPlayer(player) {
+			return fiber.NewError(fiber.StatusForbidden, "User is not a player in current game")
+		}
+		if err := b.ProcessBid(player, amount); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("When checking if bid is valid for current bid state, got error %v", err))
+		}
+		bidState = *b
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	authInfo, err := UnloadTokenCookie(c)
+
+	if bidState.Done {
+		if err = endBidding(bidState); err != nil {
+			return fmt.Errorf("When ending bidding, got error %v", err)
+		}
+		return nil
+	}
+	startBidBots(gameID)
+	return nil
+}
+
+func submitBid(c *fiber.Ctx) error {
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
-	if !bidState.HasPlayer(authInfo.Name) {
-		c.Context().SetStatusCode(fiber.StatusForbidden)
-		return c.SendString("User is not a player in current game")
-	}
 
 	bid := struct {
 		Amount int `json:"amount"`
@@ -78,50 +104,44 @@ func submitBid(c *fiber.Ctx) error {
 		return c.SendString(fmt.Sprintf("When parsing bid submission, got error %v", err))
 	}
 
-	err = bidState.ProcessBid(authInfo.Name, bid.Amount)
-	if err != nil {
-		c.Context().SetStatusCode(fiber.StatusBadRequest)
-		return c.SendString(fmt.Sprintf("When checking if bid is valid for current bid state, got error %v", err))
-	}
-
-	bidManager.Put(bidState)
-	if bidState.Done {
-		err = endBidding(bidState)
-		if err != nil {
-			c.Context().SetStatusCode(fiber.StatusInternalServerError)
-			return c.SendString(fmt.Sprintf("When ending bidding, got error %v", err))
-		}
+	if err = placeBid(authInfo.Name, c.Params("gameid"), bid.Amount); err != nil {
+		return sendUpdateError(c, err)
 	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
 
+// move a finished auction into the game manager
+// only whoever completed the auction should call this
 func endBidding(bidState game.BidState) error {
-	if _, exists := bidManager.Get(bidState.ID); !exists {
-		return fmt.Errorf("Tried to initialize a game from a BidState not in the bid manager")
-	}
 	game, err := bidState.InitGame()
 	if err != nil {
-		return fmt.Errorf("Error when initializing game from BidState: %v", err)
+		// nobody can bid in a finished auction, so don't leave it stuck in the bid manager
+		bidManager.Delete(bidState.ID, EmptyCode)
+		return fmt.Errorf("Error when initializing game from BidState, so dropped the auction: %v", err)
 	}
 	gameManager.Put(game)
-	bidManager.Delete(bidState.ID, ContinueCode)
+	if !bidManager.Delete(bidState.ID, ContinueCode) {
+		return fmt.Errorf("Tried to initialize a game from a BidState not in the bid manager")
+	}
+	// a bot that won the bid picks trump and exchanges with the widow
+	startGameBots(game.ID)
 	return nil
 }
 
 func subscribeToBids(c *fiber.Ctx) error {
 	gameID := c.Params("gameid")
-	bidState, exists := bidManager.Get(gameID)
+	bidState, exists := bidManager.GetRecent(gameID)
 	if !exists {
 		c.Context().SetStatusCode(fiber.StatusNotFound)
 		return c.SendString("Requested bid state not found in bid manager")
 	}
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
-	// require player to be member of game in order to subscribe
-	if !bidState.HasPlayer(authInfo.Name) {
+	// require player to be member of game (or the game to allow spectators) in order to subscribe
+	if !canWatch(bidState, authInfo) {
 		c.Context().SetStatusCode(fiber.StatusForbidden)
 		return c.SendString("User is not a player in current game")
 	}
@@ -135,9 +155,20 @@ func subscribeToBids(c *fiber.Ctx) error {
 	return nil
 }
 
+var bidActions = map[string]wsHandler{
+	"bid": func(authInfo JWTPayload, gameID string, action wsAction) error {
+		return placeBid(authInfo.Name, gameID, action.Amount)
+	},
+}
+
+func biddingWebSocket(conn *websocket.Conn) {
+	serveWebSocket(bidManager, conn, conn.Params("gameid"), bidActions)
+}
+
 func setupBidding(r fiber.Router) {
 	r.Put("/:gameid", startBidding)
 	r.Get("/:gameid", getBidState)
 	r.Post("/:gameid", submitBid)
 	r.Get("/:gameid/subscribe", subscribeToBids)
+	r.Get("/:gameid/ws", upgradeWebSocket(bidManager, "gameid"), websocket.New(biddingWebSocket))
 }
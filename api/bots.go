@@ -0,0 +1,347 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/db"
+	"github.com/quevivasbien/bird-game/game"
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// engines run by third parties can take empty seats, in place of the built-in strategies
+// an admin registers each bot with a callback url, and lobby hosts seat one by setting a seat's strategy to "bot:<name>"
+// bots are registered by admins, not players, since the server makes requests to whatever url is registered
+//
+// the protocol: whenever the bot has a decision to make, the server POSTs json to its url
+//
+//	{"type": "bid", "timeoutMs": 2000, "view": BidView}
+//	{"type": "widow", "timeoutMs": 2000, "view": WidowView}
+//	{"type": "play", "timeoutMs": 2000, "view": PlayView}
+//
+// views hold only what a player in the bot's seat can see; their fields are described in game/strategy.go
+// the bot has timeoutMs to answer with status 200 and
+//
+//	bid:   {"bid": 120}; anything the rules don't allow, e.g. 0, is a pass
+//	widow: {"trump": 2, "toWidow": [...], "fromWidow": [...]}; toWidow[i] from the hand is swapped for fromWidow[i]
+//	play:  {"card": {"color": 1, "value": 14}}; must be one of view.legal
+//
+// requests are signed: the X-Bird-Signature header is "sha256=" and the hex HMAC-SHA256 of the body, keyed with the bot's secret
+// if the bot is too slow, fails, or answers with something invalid, its fallback strategy decides instead
+// requests are made in the background with the table unlocked (see turns.go), so a slow bot only holds up
+// the game itself, not other requests or streams for the table
+// `go run ./bin examplebot` runs a bot that follows the protocol using a built-in strategy
+const BOT_SEAT_PREFIX = "bot:"
+
+// how long bots get to answer, in milliseconds
+const BOT_TIMEOUT_ENV = "BIRD_BOT_TIMEOUT"
+
+const DEFAULT_BOT_TIMEOUT time.Duration = time.Second * 2
+const MAX_BOT_TIMEOUT time.Duration = time.Second * 10
+
+const BOT_SIGNATURE_HEADER = "X-Bird-Signature"
+const MAX_BOT_RESPONSE_SIZE = 64 * 1024
+const MAX_BOT_DESCRIPTION_LENGTH = 200
+
+var botTimeout = DEFAULT_BOT_TIMEOUT
+var botClient = &http.Client{}
+
+func loadBots() error {
+	if value := os.Getenv(BOT_TIMEOUT_ENV); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms < 1 || time.Duration(ms)*time.Millisecond > MAX_BOT_TIMEOUT {
+			return fmt.Errorf("%s must be a number of milliseconds between 1 and %d", BOT_TIMEOUT_ENV, MAX_BOT_TIMEOUT.Milliseconds())
+		}
+		botTimeout = time.Duration(ms) * time.Millisecond
+	}
+	game.SetExternalStrategies(botStrategy)
+	return nil
+}
+
+// the strategy for a seat's "bot:<name>", if that bot is registered
+func botStrategy(seat string) (game.Strategy, bool) {
+	name, ok := strings.CutPrefix(seat, BOT_SEAT_PREFIX)
+	if !ok {
+		return nil, false
+	}
+	bot, err := storage.GetBot(name)
+	if err != nil {
+		log.Printf("When looking up bot %s: %v", name, err)
+		return nil, false
+	}
+	return &remoteStrategy{bot: bot, fallback: game.GetStrategy(bot.Fallback)}, true
+}
+
+type botRequest struct {
+	Type      string      `json:"type"`
+	TimeoutMs int64       `json:"timeoutMs"`
+	View      interface{} `json:"view"`
+}
+
+type widowReply struct {
+	Trump     game.Color  `json:"trump"`
+	ToWidow   []game.Card `json:"toWidow"`
+	FromWidow []game.Card `json:"fromWidow"`
+}
+
+// asks a registered bot for each decision; a new one is made for every lookup,
+// so the widow answer can be kept between ChooseTrump and ExchangeWidow
+type remoteStrategy struct {
+	bot      db.Bot
+	fallback game.Strategy
+	widow    *widowReply
+}
+
+func signBotRequest(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// send a decision to the bot and decode its answer into reply
+func (s *remoteStrategy) ask(kind string, view interface{}, reply interface{}) error {
+	body, err := json.Marshal(botRequest{kind, botTimeout.Milliseconds(), view})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), botTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.bot.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(BOT_SIGNATURE_HEADER, signBotRequest(s.bot.Secret, body))
+	resp, err := botClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Bot answered with status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, MAX_BOT_RESPONSE_SIZE)).Decode(reply)
+}
+
+func (s *remoteStrategy) fellBack(kind string, reason interface{}) {
+	log.Printf("Bot %s failed to answer %s request (%v); using %s strategy instead", s.bot.Name, kind, reason, s.bot.Fallback)
+}
+
+func (s *remoteStrategy) Bid(view game.BidView) int {
+	reply := struct {
+		Bid int `json:"bid"`
+	}{}
+	if err := s.ask("bid", view, &reply); err != nil {
+		s.fellBack("bid", err)
+		return s.fallback.Bid(view)
+	}
+	return reply.Bid
+}
+
+func (s *remoteStrategy) ChooseTrump(view game.WidowView) game.Color {
+	reply := widowReply{}
+	if err := s.ask("widow", view, &reply); err != nil {
+		s.fellBack("widow", err)
+		return s.fallback.ChooseTrump(view)
+	}
+	if reply.Trump < game.Red || reply.Trump > game.Black || !validExchange(view, reply.ToWidow, reply.FromWidow) {
+		s.fellBack("widow", "invalid trump or exchange")
+		return s.fallback.ChooseTrump(view)
+	}
+	s.widow = &reply
+	return reply.Trump
+}
+
+func (s *remoteStrategy) ExchangeWidow(view game.WidowView, trump game.Color) ([]game.Card, []game.Card) {
+	if s.widow == nil || s.widow.Trump != trump {
+		return s.fallback.ExchangeWidow(view, trump)
+	}
+	return s.widow.ToWidow, s.widow.FromWidow
+}
+
+func (s *remoteStrategy) PlayCard(view game.PlayView) game.Card {
+	reply := struct {
+		Card game.Card `json:"card"`
+	}{}
+	if err := s.ask("play", view, &reply); err != nil {
+		s.fellBack("play", err)
+		return s.fallback.PlayCard(view)
+	}
+	if !utils.Contains(view.Legal, reply.Card) {
+		s.fellBack("play", fmt.Sprintf("illegal card %v", reply.Card))
+		return s.fallback.PlayCard(view)
+	}
+	return reply.Card
+}
+
+// whether swapping toWidow[i] for fromWidow[i], in order, only moves cards where they are
+func validExchange(view game.WidowView, toWidow []game.Card, fromWidow []game.Card) bool {
+	if len(toWidow) != len(fromWidow) {
+		return false
+	}
+	hand := append([]game.Card{}, view.Hand...)
+	widow := append([]game.Card{}, view.Widow...)
+	for i := range toWidow {
+		h := utils.IndexOf(hand, toWidow[i])
+		w := utils.IndexOf(widow, fromWidow[i])
+		if h == -1 || w == -1 {
+			return false
+		}
+		hand[h], widow[w] = widow[w], hand[h]
+	}
+	return true
+}
+
+// what admins see of a bot; the secret is only shown when the bot is registered
+type botInfo struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Fallback    string `json:"fallback"`
+	Created     int64  `json:"created"`
+}
+
+func makeBotInfo(b db.Bot) botInfo {
+	return botInfo{b.Name, b.URL, b.Description, b.Fallback, b.Created}
+}
+
+type botSettings struct {
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Fallback    string `json:"fallback"`
+}
+
+func (s *botSettings) validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return db.InvalidUserInput{Reason: "Bot url must be an absolute http or https url"}
+	}
+	if len(s.Description) > MAX_BOT_DESCRIPTION_LENGTH {
+		return db.InvalidUserInput{Reason: fmt.Sprintf("Description can't be longer than %d characters", MAX_BOT_DESCRIPTION_LENGTH)}
+	}
+	if s.Fallback == "" {
+		s.Fallback = game.DEFAULT_STRATEGY
+	}
+	if !game.IsStrategy(s.Fallback) {
+		return db.InvalidUserInput{Reason: fmt.Sprintf("Unknown fallback strategy %s; options are %v", s.Fallback, game.StrategyNames())}
+	}
+	return nil
+}
+
+func listBotsHandler(c *fiber.Ctx) error {
+	bots, err := storage.AllBots()
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	infos := make([]botInfo, len(bots))
+	for i, b := range bots {
+		infos[i] = makeBotInfo(b)
+	}
+	return c.JSON(infos)
+}
+
+func registerBotHandler(c *fiber.Ctx) error {
+	input := struct {
+		Name string `json:"name"`
+		botSettings
+	}{}
+	if err := c.BodyParser(&input); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := db.ValidateUserName(input.Name); err != nil {
+		return sendAccountError(c, err)
+	}
+	if err := input.validate(); err != nil {
+		return sendAccountError(c, err)
+	}
+	bot, err := db.NewBot(input.Name, input.URL, input.Description, input.Fallback)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	if err := storage.PutBot(bot); err != nil {
+		return sendAccountError(c, err)
+	}
+	return c.JSON(fiber.Map{
+		"secret": bot.Secret,
+		"info":   makeBotInfo(bot),
+	})
+}
+
+func updateBotHandler(c *fiber.Ctx) error {
+	input := botSettings{}
+	if err := c.BodyParser(&input); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := input.validate(); err != nil {
+		return sendAccountError(c, err)
+	}
+	bot, err := storage.GetBot(c.Params("name"))
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	bot.URL, bot.Description, bot.Fallback = input.URL, input.Description, input.Fallback
+	if err := storage.UpdateBot(bot); err != nil {
+		return sendAccountError(c, err)
+	}
+	return c.JSON(makeBotInfo(bot))
+}
+
+// seats already holding the bot fall back to the default strategy
+func deleteBotHandler(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if _, err := storage.GetBot(name); err != nil {
+		return sendAccountError(c, err)
+	}
+	if err := storage.DeleteBot(name); err != nil {
+		return sendAccountError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// the bots lobby hosts can choose from
+func getBots(c *fiber.Ctx) error {
+	bots, err := storage.AllBots()
+	if err != nil {
+		log.Println("When listing bots:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	type publicBot struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	public := make([]publicBot, len(bots))
+	for i, b := range bots {
+		public[i] = publicBot{b.Name, b.Description}
+	}
+	return c.JSON(public)
+}
+
+// check that a lobby seat's strategy is built in or a registered bot
+func checkSeatStrategy(strategy string) error {
+	name, ok := strings.CutPrefix(strategy, BOT_SEAT_PREFIX)
+	if !ok {
+		if !game.IsStrategy(strategy) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unknown strategy %s; options are %v, or %s<name> for a registered bot", strategy, game.StrategyNames(), BOT_SEAT_PREFIX))
+		}
+		return nil
+	}
+	_, err := storage.GetBot(name)
+	if _, notFound := err.(db.ItemNotFound); notFound {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("No bot named %s is registered", name))
+	}
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 	"github.com/quevivasbien/bird-game/game"
 	"github.com/quevivasbien/bird-game/utils"
 )
@@ -12,7 +13,7 @@ import (
 var gameManager = MakeManager[game.GameState]()
 
 func getGameState(c *fiber.Ctx) error {
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
@@ -22,16 +23,20 @@ func getGameState(c *fiber.Ctx) error {
 		c.Context().SetStatusCode(fiber.StatusNotFound)
 		return c.SendString("Requested game not found in game manager")
 	}
-	userIndex := utils.IndexOf(game.Players[:], authInfo.Name)
-	if userIndex == -1 {
+	if !canWatch(game, authInfo) {
 		c.Context().SetStatusCode(fiber.StatusForbidden)
 		return c.SendString("Tried to get game state for a player not in the game")
 	}
-	return c.JSON(game.Visible(userIndex))
+	view, exists := gameManager.View(gameID, authInfo.Name)
+	if !exists {
+		c.Context().SetStatusCode(fiber.StatusTooEarly)
+		return c.SendString("Game state is not available to spectators yet")
+	}
+	return c.JSON(view)
 }
 
 func getWidow(c *fiber.Ctx) error {
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
@@ -50,79 +55,144 @@ func getWidow(c *fiber.Ctx) error {
 	return c.JSON(game.Widow)
 }
 
-// set trump and exchange cards with widow
-func startRound(c *fiber.Ctx) error {
-	_, err := UnloadTokenCookie(c)
+// list cards the requesting player may legally play right now
+func getLegalMoves(c *fiber.Ctx) error {
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
-	body := struct {
-		Trump     game.Color  `json:"trump"`
-		ToWidow   []game.Card `json:"toWidow"`
-		FromWidow []game.Card `json:"fromWidow"`
-	}{}
-	if err = c.BodyParser(&body); err != nil {
-		c.Context().SetStatusCode(fiber.StatusBadRequest)
-		return c.SendString(fmt.Sprintf("Error parsing body of start game request: %v", err))
-	}
 	gameID := c.Params("gameid")
 	game, exists := gameManager.Get(gameID)
 	if !exists {
 		c.Context().SetStatusCode(fiber.StatusNotFound)
 		return c.SendString("Requested game not found in game manager")
 	}
-	err = game.ExchangeWithWidow(body.ToWidow, body.FromWidow)
+	userIndex := utils.IndexOf(game.Players[:], authInfo.Name)
+	if userIndex == -1 {
+		c.Context().SetStatusCode(fiber.StatusForbidden)
+		return c.SendString("Tried to get legal moves for a player not in the game")
+	}
+	return c.JSON(game.LegalMoves(userIndex))
+}
+
+// what the bid winner sends to start the round
+type roundSetup struct {
+	Trump     game.Color  `json:"trump"`
+	ToWidow   []game.Card `json:"toWidow"`
+	FromWidow []game.Card `json:"fromWidow"`
+}
+
+// set trump and exchange cards with widow on behalf of player, who must be the bid winner
+func beginRound(player string, gameID string, setup roundSetup) error {
+	err := gameManager.Update(gameID, func(g *game.GameState) error {
+		if player != g.Players[g.BidWinner] {
+			return fiber.NewError(fiber.StatusForbidden, "Only the bid winner can start the round")
+		}
+		if err := g.StartRound(setup.Trump, setup.ToWidow, setup.FromWidow); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("When starting round, got error %v", err))
+		}
+		return nil
+	})
+	if err == nil {
+		startGameBots(gameID)
+	}
+	return err
+}
+
+// play card from player's hand
+func playCardAs(player string, gameID string, card game.Card) error {
+	err := gameManager.Update(gameID, func(g *game.GameState) error {
+		playerIndex := utils.IndexOf(g.Players[:], player)
+		if playerIndex == -1 {
+			return fiber.ErrForbidden
+		}
+		if err := g.PlayCard(playerIndex, card); err != nil {
+			return fiber.NewError(playErrorStatus(err), fmt.Sprintf("When trying to play card, got error %v", err))
+		}
+		return nil
+	})
+	if err == nil {
+		startGameBots(gameID)
+	}
+	return err
+}
+
+// choose a response status for an error returned by GameState.PlayCard
+func playErrorStatus(err error) int {
+	switch err.(type) {
+	case game.NotPlayersTurn, game.TableFull, game.RoundNotStarted, game.GameOver:
+		return fiber.StatusConflict
+	case game.CardNotInHand, game.MustFollowSuit:
+		return fiber.StatusUnprocessableEntity
+	default:
+		return fiber.StatusBadRequest
+	}
+}
+
+// collect a full trick for player, and score the hand in its match if that was the last trick
+func finishTrick(player string, gameID string) error {
+	var gameState game.GameState
+	err := gameManager.Update(gameID, func(g *game.GameState) error {
+		// spectators can see the game, but shouldn't move it along
+		if !g.HasPlayer(player) {
+			return fiber.NewError(fiber.StatusForbidden, "User is not a player in current game")
+		}
+		if err := g.FinishPlay(); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("When attempting to finish play, got error %v", err))
+		}
+		gameState = *g
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = recordMatchHand(gameState); err != nil {
+		return fmt.Errorf("When recording hand in match, got error %v", err)
+	}
+	startGameBots(gameID)
+	return nil
+}
+
+// set trump and exchange cards with widow
+func startRound(c *fiber.Ctx) error {
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	setup := roundSetup{}
+	if err = c.BodyParser(&setup); err != nil {
 		c.Context().SetStatusCode(fiber.StatusBadRequest)
-		return c.SendString(fmt.Sprintf("When exchanging cards with widow, got error %v", err))
+		return c.SendString(fmt.Sprintf("Error parsing body of start game request: %v", err))
+	}
+	if err = beginRound(authInfo.Name, c.Params("gameid"), setup); err != nil {
+		return sendUpdateError(c, err)
 	}
-	game.Trump = body.Trump
-	gameManager.Put(game)
 	return c.SendStatus(fiber.StatusOK)
 }
 
 func playCard(c *fiber.Ctx) error {
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
-	gameID := c.Params("gameid")
-	gameState, exists := gameManager.Get(gameID)
-	if !exists {
-		return c.SendStatus(fiber.StatusNotFound)
-	}
-	if !gameState.HasPlayer(authInfo.Name) {
-		return c.SendStatus(fiber.StatusForbidden)
-	}
 	card := game.Card{}
 	if err = c.BodyParser(&card); err != nil {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	playerIndex := utils.IndexOf(gameState.Players[:], authInfo.Name)
-	if playerIndex == -1 {
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-	err = gameState.PlayCard(playerIndex, card)
-	if err != nil {
-		c.Context().SetStatusCode(fiber.StatusBadRequest)
-		return c.SendString(fmt.Sprintf("When trying to play card, got error %v", err))
+	if err = playCardAs(authInfo.Name, c.Params("gameid"), card); err != nil {
+		return sendUpdateError(c, err)
 	}
-	gameManager.Put(gameState)
 	return c.SendStatus(fiber.StatusOK)
 }
 
 func finishPlay(c *fiber.Ctx) error {
-	gameID := c.Params("gameid")
-	game, exists := gameManager.Get(gameID)
-	if !exists {
-		return c.SendStatus(fiber.StatusNotFound)
-	}
-	err := game.FinishPlay()
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
-		c.Context().SetStatusCode(fiber.StatusBadRequest)
-		c.SendString(fmt.Sprintf("When attempting to finish play, got error %v", err))
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if err := finishTrick(authInfo.Name, c.Params("gameid")); err != nil {
+		return sendUpdateError(c, err)
 	}
-	gameManager.Put(game)
 	return c.SendStatus(fiber.StatusOK)
 }
 
@@ -132,30 +202,26 @@ func getScore(c *fiber.Ctx) error {
 	if !exists {
 		return c.SendStatus(fiber.StatusNotFound)
 	}
-	score0, score1, err := game.Score()
+	result, err := game.Score()
 	if err != nil {
 		c.Context().SetStatusCode(fiber.StatusBadRequest)
 		return c.SendString(fmt.Sprintf("When trying to get game score, got error %v", err))
 	}
-	out := struct {
-		Score0 int `json:"score0"`
-		Score1 int `json:"score1"`
-	}{score0, score1}
-	return c.JSON(out)
+	return c.JSON(result)
 }
 
 func subscribeToGame(c *fiber.Ctx) error {
 	gameID := c.Params("gameid")
-	gameState, exists := gameManager.Get(gameID)
+	gameState, exists := gameManager.GetRecent(gameID)
 	if !exists {
 		return c.SendStatus(fiber.StatusNotFound)
 	}
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
-	// require player to be member of game in order to subscribe
-	if !gameState.HasPlayer(authInfo.Name) {
+	// require player to be member of game (or the game to allow spectators) in order to subscribe
+	if !canWatch(gameState, authInfo) {
 		return c.SendStatus(fiber.StatusForbidden)
 	}
 
@@ -168,12 +234,30 @@ func subscribeToGame(c *fiber.Ctx) error {
 	return nil
 }
 
+var gameActions = map[string]wsHandler{
+	"start": func(authInfo JWTPayload, gameID string, action wsAction) error {
+		return beginRound(authInfo.Name, gameID, action.roundSetup)
+	},
+	"play": func(authInfo JWTPayload, gameID string, action wsAction) error {
+		return playCardAs(authInfo.Name, gameID, action.Card)
+	},
+	"finish": func(authInfo JWTPayload, gameID string, _ wsAction) error {
+		return finishTrick(authInfo.Name, gameID)
+	},
+}
+
+func gameWebSocket(conn *websocket.Conn) {
+	serveWebSocket(gameManager, conn, conn.Params("gameid"), gameActions)
+}
+
 func setupGames(r fiber.Router) {
 	r.Get("/:gameid", getGameState)
 	r.Get("/:gameid/widow", getWidow)
+	r.Get("/:gameid/legal", getLegalMoves)
 	r.Post("/:gameid/start", startRound)
 	r.Post("/:gameid/play", playCard)
 	r.Post("/:gameid/finish", finishPlay)
 	r.Get("/:gameid/score", getScore)
 	r.Get("/:gameid/subscribe", subscribeToGame)
+	r.Get("/:gameid/ws", upgradeWebSocket(gameManager, "gameid"), websocket.New(gameWebSocket))
 }
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/db"
+)
+
+// guests can play without registering; they get a generated name and an access token, but no session
+// or user record, so nothing is stored for anyone who just clicks through
+// a guest can later claim their name as a regular account by setting a password
+
+// registered users can't take names with this prefix, so guest names never collide with them
+const GUEST_PREFIX = "Guest-"
+
+// guests have no session to refresh their token from, so it has to last through a sitting
+const GUEST_TOKEN_LIFETIME time.Duration = time.Hour * 12
+
+// number of tries to find a guest name not already claimed by a user
+const GUEST_NAME_ATTEMPTS = 5
+
+func isGuestName(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), strings.ToLower(GUEST_PREFIX))
+}
+
+func newGuestName() (string, error) {
+	b := make([]byte, 4)
+	for i := 0; i < GUEST_NAME_ATTEMPTS; i++ {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		name := GUEST_PREFIX + hex.EncodeToString(b)
+		// claimed guest accounts keep their names
+		taken, err := storage.UserExists(name)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("Could not find an unused guest name after %d attempts", GUEST_NAME_ATTEMPTS)
+}
+
+// guests are limited to unranked games, so they can't sit at or start a ranked table
+func checkRanked(authInfo JWTPayload, ranked bool) error {
+	if ranked && authInfo.Guest {
+		return fiber.NewError(fiber.StatusForbidden, "Guests can only play unranked games; claim an account first")
+	}
+	return nil
+}
+
+func guestLoginHandler(c *fiber.Ctx) error {
+	name, err := newGuestName()
+	if err != nil {
+		log.Println("When generating guest name:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	token, userInfo, err := signToken(JWTPayload{Name: name, Guest: true}, GUEST_TOKEN_LIFETIME)
+	if err != nil {
+		log.Println("When signing guest token:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	setAccessCookie(c, token, userInfo)
+	return c.JSON(userInfo)
+}
+
+// turn the logged-in guest into a registered user with the same name
+// there are no per-player stats yet; what carries over is the guest's seats in lobbies, auctions,
+// games and matches, which refer to players by name
+func claimGuestHandler(c *fiber.Ctx) error {
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if !authInfo.Guest {
+		c.Context().SetStatusCode(fiber.StatusBadRequest)
+		return c.SendString("Only guests can claim an account")
+	}
+	input := struct {
+		Password string `json:"password"`
+	}{}
+	if err := c.BodyParser(&input); err != nil || input.Password == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	user, err := db.NewUser(authInfo.Name, input.Password, false)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+	if err := storage.PutUser(user); err != nil {
+		return sendAccountError(c, err)
+	}
+	// swap the guest token for a regular session
+	if err := denyToken(authInfo.JTI, authInfo.ExpireTime); err != nil {
+		log.Println("When denying guest token:", err)
+	}
+	userInfo, err := startSession(c, user)
+	if err != nil {
+		log.Println("When starting session for claimed user:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(userInfo)
+}
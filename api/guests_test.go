@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/game"
+)
+
+func TestGuestsKeptFromRankedTables(t *testing.T) {
+	guest := JWTPayload{Name: GUEST_PREFIX + "0000", Guest: true}
+	for _, ranked := range []bool{true, false} {
+		lobby := game.MakeLobby("rankedtest", "alice")
+		lobby.Ranked = ranked
+		lobbyManager.Put(lobby)
+		_, err := addToLobby(guest, lobby.ID)
+		if e, ok := err.(*fiber.Error); ranked && (!ok || e.Code != fiber.StatusForbidden) {
+			t.Errorf("guest sitting at a ranked table got %v", err)
+		}
+		if !ranked && err != nil {
+			t.Errorf("guest couldn't sit at an unranked table: %v", err)
+		}
+		lobbyManager.Delete(lobby.ID, EmptyCode)
+	}
+
+	// a ranked lobby can't be made by a guest, or have a match started by one
+	app := testApp(guest)
+	req := httptest.NewRequest("PUT", "/lobbies/rankedtest", strings.NewReader(`{"ranked": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("guest making a ranked lobby got status %d", resp.StatusCode)
+	}
+	if _, exists := lobbyManager.Get("rankedtest"); exists {
+		t.Error("guest made a ranked lobby")
+	}
+	lobby := game.MakeLobby("rankedtest", guest.Name)
+	lobby.Ranked = true
+	lobbyManager.Put(lobby)
+	t.Cleanup(func() { lobbyManager.Delete(lobby.ID, EmptyCode) })
+	resp, err = app.Test(httptest.NewRequest("PUT", "/matches/rankedtest", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("guest starting a ranked match got status %d", resp.StatusCode)
+	}
+	if _, exists := matchManager.Get("rankedtest"); exists {
+		t.Error("guest started a ranked match")
+	}
+}
+
+// an app with the auth and lobby routes, authenticating requests as the real server does
+func authApp() *fiber.App {
+	// like the server, so route params can be kept as lobby IDs
+	app := fiber.New(fiber.Config{Immutable: true})
+	app.Use(authenticate)
+	setupAuth(app.Group("/auth", requireSession))
+	setupLobbies(app.Group("/lobbies"))
+	return app
+}
+
+// send a request with the given access token cookie, returning the response and the cookies it sets
+func request(t *testing.T, app *fiber.App, method string, path string, body string, token string) (*http.Response, map[string]string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: JWT_COOKIE_NAME, Value: token})
+	}
+	// claiming hashes a password, which can take longer than the default timeout
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := map[string]string{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	return resp, cookies
+}
+
+func TestGuestLoginAndClaim(t *testing.T) {
+	useTestStorage(t)
+	useTestKeys(t)
+	app := authApp()
+
+	resp, cookies := request(t, app, "POST", "/auth/guest", "", "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("guest login got status %d", resp.StatusCode)
+	}
+	guestToken := cookies[JWT_COOKIE_NAME]
+	guest, err := parseAccessToken(guestToken)
+	if err != nil || !guest.Guest || !isGuestName(guest.Name) {
+		t.Fatalf("guest got token for %+v, %v", guest, err)
+	}
+	// nothing is stored until the guest claims their name
+	if _, exists := cookies[REFRESH_COOKIE_NAME]; exists {
+		t.Error("guest was given a refresh token")
+	}
+	if sessions, _ := storage.UserSessions(guest.Name); len(sessions) != 0 {
+		t.Errorf("guest login stored %d sessions", len(sessions))
+	}
+
+	lobbyID := "claimtest"
+	if resp, _ := request(t, app, "PUT", "/lobbies/"+lobbyID, "", guestToken); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("guest making a lobby got status %d", resp.StatusCode)
+	}
+	t.Cleanup(func() { lobbyManager.Delete(lobbyID, EmptyCode) })
+
+	resp, cookies = request(t, app, "POST", "/auth/claim", `{"password": "claimedpass12"}`, guestToken)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("claiming got status %d", resp.StatusCode)
+	}
+	claimed, err := parseAccessToken(cookies[JWT_COOKIE_NAME])
+	if err != nil || claimed.Guest || claimed.Name != guest.Name {
+		t.Fatalf("claimed account got token for %+v, %v", claimed, err)
+	}
+	if _, err := parseAccessToken(guestToken); err == nil {
+		t.Error("guest token still works after claiming")
+	}
+	// the claimed account keeps the guest's seat, and may now sit at ranked tables
+	if lobby, _ := lobbyManager.Get(lobbyID); lobby.Host != guest.Name || !lobby.HasPlayer(guest.Name) {
+		t.Errorf("claimed account lost its seat: %+v", lobby)
+	}
+	ranked := game.MakeLobby("claimtest-ranked", "alice")
+	ranked.Ranked = true
+	lobbyManager.Put(ranked)
+	t.Cleanup(func() { lobbyManager.Delete(ranked.ID, EmptyCode) })
+	if _, err := addToLobby(claimed, ranked.ID); err != nil {
+		t.Errorf("claimed account couldn't sit at a ranked table: %v", err)
+	}
+}
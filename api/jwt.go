@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,55 +11,180 @@ import (
 	"github.com/quevivasbien/bird-game/db"
 )
 
-var JWT_SECRET = []byte(os.Getenv("BIRD_JWT_SECRET"))
+// tokens are signed with HS256 using a secret from the environment: either BIRD_JWT_SECRET=<secret>,
+// or, to rotate keys, a comma-separated list of <kid>:<secret> in BIRD_JWT_KEYS, e.g. "new:<secret>,old:<secret>"
+// new tokens are signed with the first key; tokens signed with any listed key are accepted,
+// so an old key can be dropped once tokens signed with it have expired
+const JWT_SECRET_ENV = "BIRD_JWT_SECRET"
+const JWT_KEYS_ENV = "BIRD_JWT_KEYS"
+
+// the key id used for BIRD_JWT_SECRET
+const DEFAULT_JWT_KID = "default"
+
+// HS256 secrets shorter than this can be brute-forced
+const MIN_JWT_SECRET_LENGTH = 32
+
+var JWT_SIGNING_METHOD = jwt.SigningMethodHS256
+
+type jwtKeySet struct {
+	signingKID string
+	keys       map[string][]byte
+}
+
+var jwtKeys jwtKeySet
+
+func parseJWTKeys(secret string, keyList string) (jwtKeySet, error) {
+	if secret != "" && keyList != "" {
+		return jwtKeySet{}, fmt.Errorf("Set only one of %s and %s", JWT_SECRET_ENV, JWT_KEYS_ENV)
+	}
+	if secret != "" {
+		keyList = DEFAULT_JWT_KID + ":" + secret
+	}
+	if keyList == "" {
+		return jwtKeySet{}, fmt.Errorf("No JWT secret provided; set %s to a random string of at least %d bytes, e.g. from `openssl rand -base64 32`", JWT_SECRET_ENV, MIN_JWT_SECRET_LENGTH)
+	}
+	keySet := jwtKeySet{keys: make(map[string][]byte)}
+	for _, entry := range strings.Split(keyList, ",") {
+		kid, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || kid == "" {
+			return jwtKeySet{}, fmt.Errorf("JWT keys must be given as <kid>:<secret>")
+		}
+		if _, exists := keySet.keys[kid]; exists {
+			return jwtKeySet{}, fmt.Errorf("JWT key id %s is used more than once", kid)
+		}
+		if len(key) < MIN_JWT_SECRET_LENGTH {
+			return jwtKeySet{}, fmt.Errorf("JWT key %s is too short; secrets must be at least %d bytes", kid, MIN_JWT_SECRET_LENGTH)
+		}
+		keySet.keys[kid] = []byte(key)
+		if keySet.signingKID == "" {
+			keySet.signingKID = kid
+		}
+	}
+	return keySet, nil
+}
+
+// read and validate signing keys from the environment
+func loadJWTKeys() error {
+	keySet, err := parseJWTKeys(os.Getenv(JWT_SECRET_ENV), os.Getenv(JWT_KEYS_ENV))
+	if err != nil {
+		return err
+	}
+	jwtKeys = keySet
+	return nil
+}
+
+// look up the key a token says it was signed with
+func (k jwtKeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, exists := k.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("Unknown JWT key id %q", kid)
+	}
+	return key, nil
+}
+
+// access tokens are short-lived; clients get new ones from /api/auth/refresh using their refresh token
+const ACCESS_TOKEN_LIFETIME time.Duration = time.Minute * 15
+const REFRESH_TOKEN_LIFETIME time.Duration = time.Hour * 24 * 30
 
-const JWT_EXPIRE_HOURS = 12
 const JWT_COOKIE_NAME = "jwt_token"
+const REFRESH_COOKIE_NAME = "refresh_token"
+
+// the refresh token is only needed by the auth endpoints
+const REFRESH_COOKIE_PATH = "/api/auth"
 
 type JWTPayload struct {
 	Name       string `json:"name"`
 	Admin      bool   `json:"admin"`
 	ExpireTime int64  `json:"expireTime"`
+	Guest      bool   `json:"guest"`
+	JTI        string `json:"-"`
+	Session    string `json:"-"`
+	// set when the request was made with an api token, which only allows the listed scopes
+	APIToken string   `json:"-"`
+	Scopes   []string `json:"-"`
+}
+
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Admin   bool   `json:"admin"`
+	Guest   bool   `json:"guest,omitempty"`
+	Session string `json:"sid"`
 }
 
 type MissingToken struct{}
 
 func (t MissingToken) Error() string {
-	return "Request is missing JWT authentication cookie"
+	return "Request has no JWT cookie or bearer token"
 }
 
-func getToken(user db.User) (string, time.Time, error) {
-	expireTime := time.Now().Add(time.Hour * JWT_EXPIRE_HOURS)
-	claims := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"sub":   user.Name,
-			"admin": user.Admin,
-			"exp":   expireTime.Unix(),
-		},
-	)
-	token, err := claims.SignedString(JWT_SECRET)
-	return token, expireTime, err
+type RevokedToken struct{}
+
+func (t RevokedToken) Error() string {
+	return "JWT has been revoked"
+}
+
+func getToken(user db.User, session db.Session) (string, JWTPayload, error) {
+	return signToken(JWTPayload{Name: user.Name, Admin: user.Admin, Session: session.ID}, ACCESS_TOKEN_LIFETIME)
 }
 
-func SetTokenCookie(c *fiber.Ctx, user db.User) (JWTPayload, error) {
-	jwt, expireTime, err := getToken(user)
+// sign an access token for payload that lasts for lifetime, filling in its expiry and jti
+func signToken(payload JWTPayload, lifetime time.Duration) (string, JWTPayload, error) {
+	jti, err := db.RandomToken(16)
 	if err != nil {
-		return JWTPayload{}, err
+		return "", JWTPayload{}, err
 	}
+	expireTime := time.Now().Add(lifetime)
+	claims := jwt.NewWithClaims(JWT_SIGNING_METHOD, accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   payload.Name,
+			ExpiresAt: jwt.NewNumericDate(expireTime),
+			ID:        jti,
+		},
+		Admin:   payload.Admin,
+		Guest:   payload.Guest,
+		Session: payload.Session,
+	})
+	claims.Header["kid"] = jwtKeys.signingKID
+	token, err := claims.SignedString(jwtKeys.keys[jwtKeys.signingKID])
+	payload.ExpireTime = expireTime.Unix()
+	payload.JTI = jti
+	return token, payload, err
+}
+
+func setAccessCookie(c *fiber.Ctx, token string, payload JWTPayload) {
 	c.Cookie(&fiber.Cookie{
 		Name:     JWT_COOKIE_NAME,
-		Value:    jwt,
-		Expires:  expireTime,
+		Value:    token,
+		Expires:  time.Unix(payload.ExpireTime, 0),
 		HTTPOnly: true,
 		Secure:   true,
 		Path:     "/",
 	})
-	return JWTPayload{
-		Name:       user.Name,
-		Admin:      user.Admin,
-		ExpireTime: expireTime.Unix(),
-	}, nil
+}
+
+// issue a new access token for the session, and set it and the refresh token as cookies
+// the session is saved with the new access token recorded, so it can be denied if the session is revoked
+func setTokenCookies(c *fiber.Ctx, user db.User, session *db.Session, refreshToken string) (JWTPayload, error) {
+	token, payload, err := getToken(user, *session)
+	if err != nil {
+		return JWTPayload{}, err
+	}
+	session.AccessJTI = payload.JTI
+	session.AccessExpires = payload.ExpireTime
+	if err := storage.PutSession(*session); err != nil {
+		return JWTPayload{}, err
+	}
+	setAccessCookie(c, token, payload)
+	c.Cookie(&fiber.Cookie{
+		Name:     REFRESH_COOKIE_NAME,
+		Value:    refreshToken,
+		Expires:  time.Unix(session.Expires, 0),
+		HTTPOnly: true,
+		Secure:   true,
+		Path:     REFRESH_COOKIE_PATH,
+	})
+	return payload, nil
 }
 
 func ClearTokenCookie(c *fiber.Ctx) {
@@ -66,6 +192,13 @@ func ClearTokenCookie(c *fiber.Ctx) {
 		Name:   JWT_COOKIE_NAME,
 		Value:  "",
 		MaxAge: -1,
+		Path:   "/",
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:   REFRESH_COOKIE_NAME,
+		Value:  "",
+		MaxAge: -1,
+		Path:   REFRESH_COOKIE_PATH,
 	})
 }
 
@@ -74,20 +207,37 @@ func UnloadTokenCookie(c *fiber.Ctx) (JWTPayload, error) {
 	if cookie == "" {
 		return JWTPayload{}, MissingToken{}
 	}
-	token, err := jwt.Parse(cookie, func(t *jwt.Token) (interface{}, error) {
-		return JWT_SECRET, nil
-	})
+	return parseAccessToken(cookie)
+}
+
+// check an access token, from either the cookie or an Authorization header
+func parseAccessToken(token string) (JWTPayload, error) {
+	claims := accessClaims{}
+	_, err := jwt.ParseWithClaims(
+		token,
+		&claims,
+		jwtKeys.keyFunc,
+		jwt.WithValidMethods([]string{JWT_SIGNING_METHOD.Alg()}),
+	)
 	if err != nil {
-		return JWTPayload{}, fmt.Errorf("Error parsing jwt from request cookie: %v", err)
+		return JWTPayload{}, fmt.Errorf("Error parsing jwt from request: %v", err)
 	}
-	payload := token.Claims.(jwt.MapClaims)
-	name := payload["sub"].(string)
-	if name == "" {
+	if claims.Subject == "" {
 		return JWTPayload{}, fmt.Errorf("Empty name in parsed JWT payload")
 	}
+	if claims.ExpiresAt == nil {
+		return JWTPayload{}, fmt.Errorf("Missing expiry in parsed JWT payload")
+	}
+	// tokens from before sessions were introduced have no jti, so can't be revoked
+	if claims.ID == "" || deniedTokens.contains(claims.ID) {
+		return JWTPayload{}, RevokedToken{}
+	}
 	return JWTPayload{
-		Name:       name,
-		Admin:      payload["admin"].(bool),
-		ExpireTime: int64(payload["exp"].(float64)),
+		Name:       claims.Subject,
+		Admin:      claims.Admin,
+		ExpireTime: claims.ExpiresAt.Unix(),
+		Guest:      claims.Guest,
+		JTI:        claims.ID,
+		Session:    claims.Session,
 	}, nil
 }
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/quevivasbien/bird-game/db"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	newTestKey = strings.Repeat("n", MIN_JWT_SECRET_LENGTH)
+	oldTestKey = strings.Repeat("o", MIN_JWT_SECRET_LENGTH)
+)
+
+func useTestKeys(t *testing.T) {
+	t.Helper()
+	keySet, err := parseJWTKeys("", "new:"+newTestKey+", old:"+oldTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := jwtKeys
+	jwtKeys = keySet
+	t.Cleanup(func() { jwtKeys = old })
+}
+
+func validClaims(jti string) accessClaims {
+	return accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "bob",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			ID:        jti,
+		},
+		Session: "session",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims accessClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// read token the way it comes in on a request, from the access token cookie
+func parseCookie(token string) (JWTPayload, error) {
+	app := fiber.New()
+	c := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(c)
+	c.Request().Header.SetCookie(JWT_COOKIE_NAME, token)
+	return UnloadTokenCookie(c)
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	useTestKeys(t)
+	token, issued, err := getToken(db.User{Name: "bob", Admin: true}, db.Session{ID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseCookie(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Name != "bob" || !parsed.Admin || parsed.JTI != issued.JTI || parsed.Session != "session" {
+		t.Errorf("parsed %+v from a token issued as %+v", parsed, issued)
+	}
+	// tokens signed with a key that's being rotated out are still good
+	if _, err := parseCookie(sign(t, jwt.SigningMethodHS256, "old", []byte(oldTestKey), validClaims("jti"))); err != nil {
+		t.Errorf("token signed with the old key was rejected: %v", err)
+	}
+}
+
+func TestAccessTokenRejected(t *testing.T) {
+	useTestKeys(t)
+	expired := validClaims("jti")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	noExpiry := validClaims("jti")
+	noExpiry.ExpiresAt = nil
+	noSubject := validClaims("jti")
+	noSubject.Subject = ""
+	deniedTokens.add(db.DeniedToken{JTI: "denied", Expires: time.Now().Add(time.Minute).Unix()})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong algorithm", sign(t, jwt.SigningMethodHS512, "new", []byte(newTestKey), validClaims("jti"))},
+		{"no algorithm", sign(t, jwt.SigningMethodNone, "new", jwt.UnsafeAllowNoneSignatureType, validClaims("jti"))},
+		{"unknown kid", sign(t, jwt.SigningMethodHS256, "other", []byte(newTestKey), validClaims("jti"))},
+		{"missing kid", sign(t, jwt.SigningMethodHS256, "", []byte(newTestKey), validClaims("jti"))},
+		{"kid of another key", sign(t, jwt.SigningMethodHS256, "old", []byte(newTestKey), validClaims("jti"))},
+		{"missing jti", sign(t, jwt.SigningMethodHS256, "new", []byte(newTestKey), validClaims(""))},
+		{"denied jti", sign(t, jwt.SigningMethodHS256, "new", []byte(newTestKey), validClaims("denied"))},
+		{"expired", sign(t, jwt.SigningMethodHS256, "new", []byte(newTestKey), expired)},
+		{"no expiry", sign(t, jwt.SigningMethodHS256, "new", []byte(newTestKey), noExpiry)},
+		{"no subject", sign(t, jwt.SigningMethodHS256, "new", []byte(newTestKey), noSubject)},
+		{"garbage", "not.a.token"},
+	}
+	for _, test := range tests {
+		if payload, err := parseCookie(test.token); err == nil {
+			t.Errorf("%s: token was accepted as %+v", test.name, payload)
+		}
+	}
+}
+
+func TestParseJWTKeys(t *testing.T) {
+	short := strings.Repeat("s", MIN_JWT_SECRET_LENGTH-1)
+	tests := []struct {
+		name    string
+		secret  string
+		keyList string
+		ok      bool
+		signing string
+	}{
+		{"single secret", newTestKey, "", true, DEFAULT_JWT_KID},
+		{"key list signs with the first", "", "b:" + newTestKey + ",a:" + oldTestKey, true, "b"},
+		{"nothing set", "", "", false, ""},
+		{"both set", newTestKey, "a:" + oldTestKey, false, ""},
+		{"short secret", short, "", false, ""},
+		{"short key in list", "", "a:" + newTestKey + ",b:" + short, false, ""},
+		{"repeated kid", "", "a:" + newTestKey + ",a:" + oldTestKey, false, ""},
+		{"missing kid", "", ":" + newTestKey, false, ""},
+	}
+	for _, test := range tests {
+		keySet, err := parseJWTKeys(test.secret, test.keyList)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.ok && keySet.signingKID != test.signing {
+			t.Errorf("%s: signing with %s, expected %s", test.name, keySet.signingKID, test.signing)
+		}
+	}
+}
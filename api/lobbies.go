@@ -1,26 +1,41 @@
 package api
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 	"github.com/quevivasbien/bird-game/game"
+	"github.com/quevivasbien/bird-game/utils"
 )
 
 var lobbyManager = MakeManager[game.Lobby]()
 
 func createLobby(c *fiber.Ctx) error {
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
+	settings := struct {
+		Ranked bool `json:"ranked"`
+	}{}
+	if len(c.Body()) != 0 {
+		if err := c.BodyParser(&settings); err != nil {
+			c.Context().SetStatusCode(fiber.StatusBadRequest)
+			return c.SendString(fmt.Sprintf("When parsing lobby settings, got error %v", err))
+		}
+	}
+	if err := checkRanked(authInfo, settings.Ranked); err != nil {
+		return sendUpdateError(c, err)
+	}
 	lobbyID := c.Params("lobby")
-	if _, exists := lobbyManager.Get(lobbyID); exists {
+	defer seatLocks.lock(authInfo.Name)()
+	lobby := game.MakeLobby(lobbyID, authInfo.Name)
+	lobby.Ranked = settings.Ranked
+	if !lobbyManager.Insert(lobby) {
 		return c.SendStatus(fiber.StatusConflict)
 	}
-	lobby := game.MakeLobby(lobbyID, authInfo.Name)
-
-	lobbyManager.Put(lobby)
 	return c.JSON(lobby)
 }
 
@@ -35,16 +50,16 @@ func getLobbyState(c *fiber.Ctx) error {
 
 func subscribeToLobby(c *fiber.Ctx) error {
 	lobbyID := c.Params("lobby")
-	lobby, exists := lobbyManager.Get(lobbyID)
+	lobby, exists := lobbyManager.GetRecent(lobbyID)
 	if !exists {
 		return c.SendStatus(fiber.StatusNotFound)
 	}
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
-	// require player to be member of lobby in order to subscribe
-	if !lobby.HasPlayer(authInfo.Name) && !authInfo.Admin {
+	// require player to be member of lobby (or the lobby to allow spectators) in order to subscribe
+	if !canWatch(lobby, authInfo) {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
@@ -65,92 +80,241 @@ func swapLobbyOrder(c *fiber.Ctx) error {
 	if err := c.BodyParser(&swap); err != nil {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	authInfo, err := UnloadTokenCookie(c)
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
-	lobbyID := c.Params("lobby")
-	lobby, exists := lobbyManager.Get(lobbyID)
-	if !exists {
-		return c.SendStatus(fiber.StatusNotFound)
+	if swap.I < 0 || swap.I > 3 || swap.J < 0 || swap.J > 3 {
+		c.Context().SetStatusCode(fiber.StatusBadRequest)
+		return c.SendString("Positions must be between 0 and 3")
 	}
-	if !(lobby.Host == authInfo.Name || authInfo.Admin) {
-		log.Printf("Attempted to swap lobby order with name %s, lobby host %s, and admin status = %v", authInfo.Name, lobby.Host, authInfo.Admin)
-		return c.SendStatus(fiber.StatusForbidden)
+	lobbyID := c.Params("lobby")
+	err = lobbyManager.Update(lobbyID, func(lobby *game.Lobby) error {
+		if !(lobby.Host == authInfo.Name || authInfo.Admin) {
+			log.Printf("Attempted to swap lobby order with name %s, lobby host %s, and admin status = %v", authInfo.Name, lobby.Host, authInfo.Admin)
+			return fiber.ErrForbidden
+		}
+		i, j := swap.I, swap.J
+		lobby.Players[i], lobby.Players[j] = lobby.Players[j], lobby.Players[i]
+		return nil
+	})
+	if err != nil {
+		return sendUpdateError(c, err)
 	}
-	i, j := swap.I, swap.J
-	lobby.Players[i], lobby.Players[j] = lobby.Players[j], lobby.Players[i]
-	lobbyManager.Put(lobby)
 	return c.SendStatus(fiber.StatusAccepted)
 }
 
-func joinLobby(c *fiber.Ctx) error {
-	authInfo, err := UnloadTokenCookie(c)
+// set house rules for the game; only allowed for the host, before bidding starts
+func setLobbyRules(c *fiber.Ctx) error {
+	rules := game.DefaultRules()
+	if err := c.BodyParser(&rules); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
-	lobbyID := c.Params("lobby")
-	lobby, exists := lobbyManager.Get(lobbyID)
-	if !exists {
-		return c.SendStatus(fiber.StatusNotFound)
+	if err = rules.Validate(); err != nil {
+		c.Context().SetStatusCode(fiber.StatusBadRequest)
+		return c.SendString(fmt.Sprintf("Invalid rules: %v", err))
 	}
-	for i, player := range lobby.Players {
-		if player == "" {
-			lobby.Players[i] = authInfo.Name
-			lobbyManager.Put(lobby)
-			return c.JSON(lobby)
+	lobbyID := c.Params("lobby")
+	var lobby game.Lobby
+	err = lobbyManager.Update(lobbyID, func(l *game.Lobby) error {
+		if !(l.Host == authInfo.Name || authInfo.Admin) {
+			return fiber.ErrForbidden
 		}
+		l.Rules = rules
+		lobby = *l
+		return nil
+	})
+	if err != nil {
+		return sendUpdateError(c, err)
 	}
-	// lobby is full
-	return c.SendStatus(fiber.StatusConflict)
+	return c.JSON(lobby)
 }
 
-func leaveLobby(c *fiber.Ctx) error {
-	userInfo, err := UnloadTokenCookie(c)
-	if err != nil || userInfo.Name == "" {
-		c.SendStatus(fiber.StatusUnauthorized)
+// choose the strategy used by the bot in an empty seat, or seat a registered bot
+func setLobbyBot(c *fiber.Ctx) error {
+	body := struct {
+		Seat     int    `json:"seat"`
+		Strategy string `json:"strategy"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if body.Seat < 0 || body.Seat > 3 {
+		c.Context().SetStatusCode(fiber.StatusBadRequest)
+		return c.SendString("Seat must be between 0 and 3")
+	}
+	if err := checkSeatStrategy(body.Strategy); err != nil {
+		return sendAccountError(c, err)
 	}
-
 	lobbyID := c.Params("lobby")
-	lobby, exists := lobbyManager.Get(lobbyID)
-	if !exists {
-		return c.SendStatus(fiber.StatusNotFound)
+	var lobby game.Lobby
+	err = lobbyManager.Update(lobbyID, func(l *game.Lobby) error {
+		if !(l.Host == authInfo.Name || authInfo.Admin) {
+			return fiber.ErrForbidden
+		}
+		l.Bots[body.Seat] = body.Strategy
+		lobby = *l
+		return nil
+	})
+	if err != nil {
+		return sendUpdateError(c, err)
 	}
+	return c.JSON(lobby)
+}
 
-	for i, player := range lobby.Players {
-		if player == userInfo.Name {
-			lobby.Players[i] = ""
+// choose whether people outside the game can watch, and whether they can see hands
+func setLobbySpectating(c *fiber.Ctx) error {
+	settings := game.DefaultSpectatorSettings()
+	if err := c.BodyParser(&settings); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if err = settings.Validate(); err != nil {
+		c.Context().SetStatusCode(fiber.StatusBadRequest)
+		return c.SendString(fmt.Sprintf("Invalid spectator settings: %v", err))
+	}
+	lobbyID := c.Params("lobby")
+	var lobby game.Lobby
+	err = lobbyManager.Update(lobbyID, func(l *game.Lobby) error {
+		if !(l.Host == authInfo.Name || authInfo.Admin) {
+			return fiber.ErrForbidden
 		}
+		l.Spectating = settings
+		lobby = *l
+		return nil
+	})
+	if err != nil {
+		return sendUpdateError(c, err)
 	}
+	return c.JSON(lobby)
+}
+
+func getStrategies(c *fiber.Ctx) error {
+	return c.JSON(game.StrategyNames())
+}
+
+// put the user in the first empty seat of a lobby
+func addToLobby(authInfo JWTPayload, lobbyID string) (game.Lobby, error) {
+	player := authInfo.Name
+	defer seatLocks.lock(player)()
+	var lobby game.Lobby
+	err := lobbyManager.Update(lobbyID, func(l *game.Lobby) error {
+		if l.HasPlayer(player) {
+			lobby = *l
+			return nil
+		}
+		if err := checkRanked(authInfo, l.Ranked); err != nil {
+			return err
+		}
+		for i, p := range l.Players {
+			if p == "" {
+				l.Players[i] = player
+				// they may have been watching before taking the seat
+				l.Spectators = utils.Without(l.Spectators, player)
+				lobby = *l
+				return nil
+			}
+		}
+		return fiber.NewError(fiber.StatusConflict, "Lobby is full")
+	})
+	return lobby, err
+}
+
+// take player out of a lobby, deleting the lobby if nobody is left
+func removeFromLobby(player string, lobbyID string) error {
+	empty := false
+	err := lobbyManager.Update(lobbyID, func(lobby *game.Lobby) error {
+		for i, p := range lobby.Players {
+			if p == player {
+				lobby.Players[i] = ""
+			}
+		}
 
-	// if player is host, set new host; delete game if no host remains
-	lobby.Host = ""
-	for _, player := range lobby.Players {
-		if player != "" {
-			lobby.Host = player
+		// if player is host, set new host; delete game if no host remains
+		// spectators leaving don't change anything
+		if lobby.Host == player {
+			lobby.Host = ""
+			for _, p := range lobby.Players {
+				if p != "" {
+					lobby.Host = p
+				}
+			}
 		}
+		empty = lobby.Host == ""
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	if lobby.Host == "" {
+
+	if empty {
 		lobbyManager.Delete(lobbyID, EmptyCode)
-		return c.SendStatus(fiber.StatusOK)
 	} else {
-		lobbyManager.Unsubscribe(lobbyID, userInfo.Name)
+		lobbyManager.Unsubscribe(lobbyID, player)
 	}
+	return nil
+}
 
-	lobbyManager.Put(lobby)
+func joinLobby(c *fiber.Ctx) error {
+	authInfo, err := getAuthInfo(c)
 	if err != nil {
-		log.Println("When updating lobby players on db:", err)
-		return c.SendStatus(fiber.StatusInternalServerError)
+		return c.SendStatus(fiber.StatusUnauthorized)
 	}
+	lobby, err := addToLobby(authInfo, c.Params("lobby"))
+	if err != nil {
+		return sendUpdateError(c, err)
+	}
+	return c.JSON(lobby)
+}
 
+func leaveLobby(c *fiber.Ctx) error {
+	userInfo, err := getAuthInfo(c)
+	if err != nil || userInfo.Name == "" {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if err = removeFromLobby(userInfo.Name, c.Params("lobby")); err != nil {
+		return sendUpdateError(c, err)
+	}
 	return c.SendStatus(fiber.StatusOK)
 }
 
+var lobbyActions = map[string]wsHandler{
+	// only members and spectators can connect, so this is how a spectator takes a seat
+	"join": func(authInfo JWTPayload, lobbyID string, _ wsAction) error {
+		_, err := addToLobby(authInfo, lobbyID)
+		return err
+	},
+	"leave": func(authInfo JWTPayload, lobbyID string, _ wsAction) error {
+		return removeFromLobby(authInfo.Name, lobbyID)
+	},
+}
+
+func lobbyWebSocket(conn *websocket.Conn) {
+	serveWebSocket(lobbyManager, conn, conn.Params("lobby"), lobbyActions)
+}
+
 func setupLobbies(r fiber.Router) {
+	r.Get("/strategies", getStrategies)
+	r.Get("/bots", getBots)
 	r.Put("/:lobby", createLobby)
 	r.Get("/:lobby", getLobbyState)
 	r.Get("/:lobby/subscribe", subscribeToLobby)
+	r.Get("/:lobby/ws", upgradeWebSocket(lobbyManager, "lobby"), websocket.New(lobbyWebSocket))
 	r.Post("/:lobby/swap", swapLobbyOrder)
+	r.Post("/:lobby/rules", setLobbyRules)
+	r.Post("/:lobby/bots", setLobbyBot)
+	r.Post("/:lobby/spectating", setLobbySpectating)
 	r.Post("/:lobby/join", joinLobby)
 	r.Post("/:lobby/leave", leaveLobby)
 }
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"sort"
+	"sync"
+)
+
+// mutexes identified by a string, created when first locked and dropped when nobody holds them
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	holders int // lockers holding or waiting for the lock
+}
+
+func makeKeyLocks() *keyLocks {
+	return &keyLocks{locks: make(map[string]*keyLock)}
+}
+
+// lock keys, returning a function that unlocks them
+// keys are always locked in the same order so that two lockers can't each hold one the other needs
+func (k *keyLocks) lock(keys ...string) func() {
+	keys = append([]string{}, keys...)
+	sort.Strings(keys)
+	k.mu.Lock()
+	locks := make([]*keyLock, len(keys))
+	for i, key := range keys {
+		l, exists := k.locks[key]
+		if !exists {
+			l = &keyLock{}
+			k.locks[key] = l
+		}
+		l.holders++
+		locks[i] = l
+	}
+	k.mu.Unlock()
+	for _, l := range locks {
+		l.Lock()
+	}
+	return func() {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		for i, l := range locks {
+			l.Unlock()
+			l.holders--
+			if l.holders == 0 {
+				delete(k.locks, keys[i])
+			}
+		}
+	}
+}
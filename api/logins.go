@@ -0,0 +1,257 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/db"
+)
+
+// failed password checks are counted per IP address and per user name
+// after a few free failures, each further attempt has to wait twice as long as the last,
+// and after many failures the IP or name is locked out for a while
+// counts are forgotten once there have been no failures for a whole window, or, for names, after a successful login
+
+type loginLimits struct {
+	FreeFailures    int
+	BaseBackoff     time.Duration
+	MaxBackoff      time.Duration
+	LockoutFailures int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+var limits = loginLimits{
+	FreeFailures:    3,
+	BaseBackoff:     time.Second,
+	MaxBackoff:      time.Minute * 5,
+	LockoutFailures: 10,
+	LockoutDuration: time.Minute * 15,
+	Window:          time.Hour,
+}
+
+// environment variables that override the default limits; durations are in seconds
+const (
+	LOGIN_FREE_FAILURES_ENV    = "BIRD_LOGIN_FREE_FAILURES"
+	LOGIN_MAX_BACKOFF_ENV      = "BIRD_LOGIN_MAX_BACKOFF"
+	LOGIN_LOCKOUT_FAILURES_ENV = "BIRD_LOGIN_LOCKOUT_FAILURES"
+	LOGIN_LOCKOUT_DURATION_ENV = "BIRD_LOGIN_LOCKOUT_DURATION"
+	LOGIN_WINDOW_ENV           = "BIRD_LOGIN_WINDOW"
+)
+
+func loadLoginLimits() error {
+	readInt := func(env string, dest *int) error {
+		value := os.Getenv(env)
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("%s must be a positive integer", env)
+		}
+		*dest = n
+		return nil
+	}
+	readSeconds := func(env string, dest *time.Duration) error {
+		seconds := int(*dest / time.Second)
+		if err := readInt(env, &seconds); err != nil {
+			return err
+		}
+		*dest = time.Duration(seconds) * time.Second
+		return nil
+	}
+	errs := []error{
+		readInt(LOGIN_FREE_FAILURES_ENV, &limits.FreeFailures),
+		readSeconds(LOGIN_MAX_BACKOFF_ENV, &limits.MaxBackoff),
+		readInt(LOGIN_LOCKOUT_FAILURES_ENV, &limits.LockoutFailures),
+		readSeconds(LOGIN_LOCKOUT_DURATION_ENV, &limits.LockoutDuration),
+		readSeconds(LOGIN_WINDOW_ENV, &limits.Window),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	if limits.LockoutFailures <= limits.FreeFailures {
+		return fmt.Errorf("%s must be greater than %s", LOGIN_LOCKOUT_FAILURES_ENV, LOGIN_FREE_FAILURES_ENV)
+	}
+	return nil
+}
+
+type TooManyAttempts struct {
+	RetryAfter time.Duration
+}
+
+// whole seconds to wait, rounded up
+func (e TooManyAttempts) Seconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+func (e TooManyAttempts) Error() string {
+	return fmt.Sprintf("Too many failed login attempts; try again in %d seconds", e.Seconds())
+}
+
+// how long to wait before another attempt is allowed, given the failures recorded so far
+func (l loginLimits) wait(a db.LoginAttempts, now time.Time) time.Duration {
+	if locked := time.Unix(a.LockedUntil, 0); now.Before(locked) {
+		return locked.Sub(now)
+	}
+	if a.Failures < l.FreeFailures {
+		return 0
+	}
+	backoff := l.BaseBackoff << (a.Failures - l.FreeFailures)
+	// checking for <= 0 catches overflow from the shift
+	if backoff <= 0 || backoff > l.MaxBackoff {
+		backoff = l.MaxBackoff
+	}
+	next := time.Unix(a.LastFailure, 0).Add(backoff)
+	if now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+func (l loginLimits) recordFailure(a *db.LoginAttempts, now time.Time) {
+	if now.Sub(time.Unix(a.LastFailure, 0)) > l.Window {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailure = now.Unix()
+	if a.Failures >= l.LockoutFailures {
+		a.LockedUntil = now.Add(l.LockoutDuration).Unix()
+	}
+}
+
+// attempt counts are read and updated under a lock per key,
+// so that logins from different IPs for different names don't wait on each other's storage calls
+var attemptLocks = makeKeyLocks()
+
+func ipAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+func userAttemptsKey(name string) string {
+	return "user:" + name
+}
+
+// an attempt counted against an IP and name before the password was checked
+type reservation struct {
+	ip   string
+	name string
+	// the IP's attempts before and after the reservation
+	prevIP     db.LoginAttempts
+	reservedIP db.LoginAttempts
+}
+
+// count an attempt against the IP and name before the password is checked, so that
+// concurrent guesses can't all get in before any failure is recorded
+func reserveAttempt(ip string, name string) (reservation, error) {
+	keys := []string{ipAttemptsKey(ip), userAttemptsKey(name)}
+	defer attemptLocks.lock(keys...)()
+	now := time.Now()
+	attempts := make([]db.LoginAttempts, len(keys))
+	for i, key := range keys {
+		a, err := storage.GetLoginAttempts(key)
+		if err != nil {
+			return reservation{}, err
+		}
+		if wait := limits.wait(a, now); wait > 0 {
+			return reservation{}, TooManyAttempts{wait}
+		}
+		attempts[i] = a
+	}
+	r := reservation{ip: ip, name: name, prevIP: attempts[0]}
+	for i, a := range attempts {
+		limits.recordFailure(&a, now)
+		if err := storage.PutLoginAttempts(a); err != nil {
+			return r, err
+		}
+		if i == 0 {
+			r.reservedIP = a
+		}
+	}
+	return r, nil
+}
+
+// undo a reserved attempt that turned out to be successful
+func (r reservation) release() error {
+	defer attemptLocks.lock(ipAttemptsKey(r.ip), userAttemptsKey(r.name))()
+	if err := storage.DeleteLoginAttempts(userAttemptsKey(r.name)); err != nil {
+		return err
+	}
+	// don't clear the IP's count, since one IP could be guessing at many names
+	a, err := storage.GetLoginAttempts(ipAttemptsKey(r.ip))
+	if err != nil {
+		return err
+	}
+	if a == r.reservedIP {
+		return storage.PutLoginAttempts(r.prevIP)
+	}
+	// other failures were recorded in the meantime, so just take back this one
+	if a.Failures > 0 {
+		a.Failures--
+	}
+	// the IP wasn't locked when the attempt was reserved, so any lock now is from failures since then;
+	// it stands unless it took this attempt to reach the lockout count
+	if a.Failures < limits.LockoutFailures {
+		a.LockedUntil = 0
+	}
+	return storage.PutLoginAttempts(a)
+}
+
+func auditFailedLogin(ip string, name string, reason string) {
+	entry, err := db.NewLoginAuditEntry(name, ip, reason)
+	if err == nil {
+		err = storage.AddLoginAudit(entry)
+	}
+	if err != nil {
+		log.Println("When recording failed login:", err)
+	}
+}
+
+// check name and password, subject to rate limits
+// returns TooManyAttempts if the IP or name has failed too often recently
+func checkLogin(c *fiber.Ctx, name string, password string) (bool, db.User, error) {
+	ip := c.IP()
+	r, err := reserveAttempt(ip, name)
+	if err != nil {
+		if _, ok := err.(TooManyAttempts); ok {
+			auditFailedLogin(ip, name, "rate limited")
+		}
+		return false, db.User{}, err
+	}
+	ok, user, err := storage.ValidateUser(name, password)
+	if err != nil {
+		return false, db.User{}, err
+	}
+	if !ok {
+		auditFailedLogin(ip, name, "wrong name or password")
+		return false, db.User{}, nil
+	}
+	if err := r.release(); err != nil {
+		log.Println("When clearing login attempts:", err)
+	}
+	return true, user, nil
+}
+
+func sendTooManyAttempts(c *fiber.Ctx, err TooManyAttempts) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(err.Seconds()))
+	c.Context().SetStatusCode(fiber.StatusTooManyRequests)
+	return c.SendString(err.Error())
+}
+
+// failed logins since the given unix time, for admins to review
+func loginAuditHandler(c *fiber.Ctx) error {
+	since := int64(c.QueryInt("since", int(time.Now().Add(-time.Hour*24).Unix())))
+	entries, err := storage.LoginAudit(since)
+	if err != nil {
+		log.Println("When reading login audit:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(entries)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quevivasbien/bird-game/db"
+)
+
+// point storage at a fresh bolt database for the length of the test
+func useTestStorage(t *testing.T) {
+	t.Helper()
+	s, err := db.OpenBoltStore(filepath.Join(t.TempDir(), "bird.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := storage
+	storage = s
+	t.Cleanup(func() {
+		storage = old
+		s.Close()
+	})
+}
+
+var testLimits = loginLimits{
+	FreeFailures:    2,
+	BaseBackoff:     time.Second,
+	MaxBackoff:      time.Second * 8,
+	LockoutFailures: 6,
+	LockoutDuration: time.Minute,
+	Window:          time.Hour,
+}
+
+func useTestLimits(t *testing.T) {
+	old := limits
+	limits = testLimits
+	t.Cleanup(func() { limits = old })
+}
+
+func TestLoginBackoff(t *testing.T) {
+	start := time.Unix(1_000_000, 0)
+	a := db.LoginAttempts{Key: "user:bob"}
+	// wait after each failure, recorded a second apart
+	want := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, time.Minute}
+	for i, w := range want {
+		now := start.Add(time.Duration(i) * time.Second)
+		testLimits.recordFailure(&a, now)
+		if got := testLimits.wait(a, now); got != w {
+			t.Errorf("after %d failures, wait is %v, expected %v", a.Failures, got, w)
+		}
+	}
+	// the lockout lasts its full length, then backoff picks up where it was
+	now := start.Add(5*time.Second + time.Minute)
+	if got := testLimits.wait(a, now); got != 0 {
+		t.Errorf("still waiting %v after the lockout ended", got)
+	}
+	// failures are forgotten once a whole window passes without any
+	now = now.Add(testLimits.Window + time.Second)
+	testLimits.recordFailure(&a, now)
+	if a.Failures != 1 || testLimits.wait(a, now) != 0 {
+		t.Errorf("after a quiet window, failures are %d with wait %v", a.Failures, testLimits.wait(a, now))
+	}
+}
+
+func TestReserveAndRelease(t *testing.T) {
+	useTestStorage(t)
+	useTestLimits(t)
+	r, err := reserveAttempt("1.2.3.4", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.release(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{ipAttemptsKey("1.2.3.4"), userAttemptsKey("bob")} {
+		if a, _ := storage.GetLoginAttempts(key); a.Failures != 0 {
+			t.Errorf("%s has %d failures after a successful login", key, a.Failures)
+		}
+	}
+}
+
+func TestReleaseKeepsOthersLockout(t *testing.T) {
+	useTestStorage(t)
+	useTestLimits(t)
+	ip := "1.2.3.4"
+	r, err := reserveAttempt(ip, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// while bob's password is being checked, guesses at other names from the same IP lock it out
+	a, _ := storage.GetLoginAttempts(ipAttemptsKey(ip))
+	now := time.Now()
+	for a.Failures < testLimits.LockoutFailures {
+		testLimits.recordFailure(&a, now)
+	}
+	a.Failures += 2
+	storage.PutLoginAttempts(a)
+	if err := r.release(); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ = storage.GetLoginAttempts(ipAttemptsKey(ip)); limits.wait(a, time.Now()) == 0 {
+		t.Errorf("bob's login unlocked an IP with %d other failures", a.Failures)
+	}
+
+	// if bob's attempt is what reached the lockout, taking it back lifts the lock
+	ip = "5.6.7.8"
+	a = db.LoginAttempts{Key: ipAttemptsKey(ip), Failures: testLimits.LockoutFailures - 2, LastFailure: time.Now().Add(-time.Hour / 2).Unix()}
+	storage.PutLoginAttempts(a)
+	r, err = reserveAttempt(ip, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ = storage.GetLoginAttempts(ipAttemptsKey(ip))
+	testLimits.recordFailure(&a, time.Now())
+	storage.PutLoginAttempts(a)
+	if err := r.release(); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ = storage.GetLoginAttempts(ipAttemptsKey(ip)); a.LockedUntil != 0 {
+		t.Errorf("IP is still locked with %d failures after bob's attempt was taken back", a.Failures)
+	}
+}
+
+func TestConcurrentReservations(t *testing.T) {
+	useTestStorage(t)
+	useTestLimits(t)
+	// failures are timed to the second, so make sure the first backoff can't run out mid-test
+	limits.BaseBackoff = time.Minute
+	const tries = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < tries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := reserveAttempt("1.2.3.4", "bob")
+			if _, limited := err.(TooManyAttempts); err != nil && !limited {
+				t.Error(err)
+			}
+			if err == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// guesses sent all at once only get the free failures, then have to back off
+	if reserved != testLimits.FreeFailures {
+		t.Errorf("%d of %d simultaneous guesses got through, expected %d", reserved, tries, testLimits.FreeFailures)
+	}
+}
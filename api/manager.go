@@ -5,66 +5,494 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/db"
 	"github.com/quevivasbien/bird-game/utils"
 	"github.com/valyala/fasthttp"
 )
 
+// how often to send a comment down idle streams, so dead connections are noticed
+const HEARTBEAT_INTVL time.Duration = time.Second * 15
+
+// number of past versions of each item kept for clients resuming with Last-Event-ID
+const REPLAY_BUFFER_SIZE = 32
+
+// how long a deleted item is remembered, so clients that reconnect late still hear why it went away
+const TOMBSTONE_TTL time.Duration = time.Minute * 2
+
 type CloseCode int
 
 const (
 	ContinueCode CloseCode = iota
 	EmptyCode
+	ReplacedCode // the subscriber opened a newer stream; end this one quietly
 )
 
+type ItemNotFound struct {
+	ID string
+}
+
+func (e ItemNotFound) Error() string {
+	return fmt.Sprintf("Item %s not found in manager", e.ID)
+}
+
+// a version of an item, numbered in the order it was written
+type event[T utils.Manageable] struct {
+	id   int
+	at   time.Time
+	item T
+}
+
+type closeEvent struct {
+	id   int
+	code CloseCode
+}
+
+// channels are buffered so that writers never wait on a slow reader;
+// data only ever holds the most recent version of the item
 type Subscription[T utils.Manageable] struct {
-	data  chan T
-	close chan CloseCode
+	data  chan event[T]
+	close chan closeEvent
+}
+
+func makeSubscription[T utils.Manageable]() *Subscription[T] {
+	return &Subscription[T]{make(chan event[T], 1), make(chan closeEvent, 1)}
+}
+
+// replace any update the subscriber hasn't read yet with ev
+// only call while holding the lock of the entry the subscription belongs to
+func (s *Subscription[T]) send(ev event[T]) {
+	select {
+	case <-s.data:
+	default:
+	}
+	s.data <- ev
+}
+
+// an item along with its subscribers and recent history
+// mu must be held to read or write any of the fields
+type entry[T utils.Manageable] struct {
+	mu      sync.Mutex
+	item    T
+	subs    map[string]*Subscription[T]
+	seq     int        // id of the latest event
+	history []event[T] // up to REPLAY_BUFFER_SIZE most recent versions, oldest first
+	deleted bool
+	closed  closeEvent // why the item was deleted; only set if deleted
 }
 
+// start a new entry; seq continues from any earlier item with the same ID
+func makeEntry[T utils.Manageable](seq int) *entry[T] {
+	return &entry[T]{subs: make(map[string]*Subscription[T]), seq: seq}
+}
+
+// store item as the latest version and send it to subscribers
+func (e *entry[T]) set(item T) {
+	e.item = item
+	e.notify()
+}
+
+func (e *entry[T]) notify() {
+	e.seq++
+	ev := event[T]{e.seq, time.Now(), e.item}
+	e.history = append(e.history, ev)
+	if len(e.history) > REPLAY_BUFFER_SIZE {
+		e.history = e.history[len(e.history)-REPLAY_BUFFER_SIZE:]
+	}
+	for _, s := range e.subs {
+		s.send(ev)
+	}
+}
+
+// whether every event after lastID is still in the history, and there's at least one
+func (e *entry[T]) canReplay(lastID int) bool {
+	return len(e.history) != 0 && lastID >= e.history[0].id-1 && lastID < e.history[len(e.history)-1].id
+}
+
+// events a client that last saw lastID needs to catch up
+// if lastID is too old to replay (or unknown, i.e. -1), just the latest version is returned
+func (e *entry[T]) since(lastID int) []event[T] {
+	if len(e.history) == 0 {
+		return nil
+	}
+	if !e.canReplay(lastID) {
+		// can't replay, or client is already up to date; either way it gets a fresh snapshot
+		return []event[T]{e.history[len(e.history)-1]}
+	}
+	return append([]event[T]{}, e.history[lastID-e.history[0].id+1:]...)
+}
+
+// let the item know whether subscriber has a live stream, if it keeps track of that
+func (e *entry[T]) setConnected(subscriber string, connected bool) {
+	if c, ok := any(&e.item).(utils.Connectable); ok {
+		c.SetConnected(subscriber, connected)
+		e.notify()
+	}
+}
+
+// holds live items that players can subscribe to
+// mu guards the entries map; each entry has its own lock so that work on one item doesn't block others
+// deleted items stay in the map as tombstones for TOMBSTONE_TTL
 type Manager[T utils.Manageable] struct {
-	items map[string]T
-	subs  map[string](map[string]Subscription[T])
+	mu      sync.RWMutex
+	entries map[string]*entry[T]
+	// set by Persist; dirty holds IDs changed since they were last saved
+	kind    string
+	store   db.SnapshotStore
+	dirtyMu sync.Mutex
+	dirty   map[string]bool
 }
 
-func (m Manager[T]) Get(id string) (T, bool) {
-	item, exists := m.items[id]
-	return item, exists
+func (m *Manager[T]) getEntry(id string) (*entry[T], bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, exists := m.entries[id]
+	return e, exists
 }
 
-func (m *Manager[T]) Put(item T) {
+// write item as the latest version of its ID, unless replace is false and a live item exists
+// returns whether item was written
+func (m *Manager[T]) write(item T, replace bool) bool {
 	id := item.GetID()
-	m.items[id] = item
-	subs, exists := m.subs[id]
+	defer m.markDirty(id)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seq := 0
+	if e, exists := m.entries[id]; exists {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if !e.deleted {
+			if !replace {
+				return false
+			}
+			e.set(item)
+			return true
+		}
+		seq = e.seq
+	}
+	// nobody else can see the new entry until it's in the map, so no need to lock it
+	e := makeEntry[T](seq)
+	e.set(item)
+	m.entries[id] = e
+	return true
+}
+
+func (m *Manager[T]) Get(id string) (T, bool) {
+	e, exists := m.getEntry(id)
 	if !exists {
-		m.subs[id] = make(map[string]Subscription[T])
-		return
+		var zero T
+		return zero, false
 	}
-	for _, s := range subs {
-		s.data <- item
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.item, !e.deleted
+}
+
+// like Get, but also returns the last version of an item deleted within TOMBSTONE_TTL
+// useful for checking who may subscribe to an item that may have just moved on
+func (m *Manager[T]) GetRecent(id string) (T, bool) {
+	e, exists := m.getEntry(id)
+	if !exists {
+		var zero T
+		return zero, false
 	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.item, true
 }
 
-func (m *Manager[T]) Delete(id string, code CloseCode) {
-	delete(m.items, id)
-	subs, exists := m.subs[id]
+// what subscriber is allowed to see of an item right now: the latest version for players,
+// and for spectators the latest version that has been held back long enough
+// returns false if there's no such version
+func (m *Manager[T]) View(id string, subscriber string) (interface{}, bool) {
+	e, exists := m.getEntry(id)
 	if !exists {
-		return
+		return nil, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.deleted {
+		return nil, false
 	}
-	for _, s := range subs {
-		s.close <- code
+	s := stream[T]{subscriber: subscriber, pending: append([]event[T]{}, e.history...)}
+	ready := s.ready()
+	if len(ready) == 0 {
+		return nil, false
 	}
-	delete(m.subs, id)
+	item := ready[len(ready)-1].item
+	return item.Visible(utils.IndexOf(item.GetPlayers(), subscriber)), true
 }
 
-func (m *Manager[T]) Subscribe(id string, subscriber string, c *fiber.Ctx) error {
-	_, exists := m.subs[id]
+// IDs of all live items
+func (m *Manager[T]) IDs() []string {
+	m.mu.RLock()
+	entries := make(map[string]*entry[T], len(m.entries))
+	for id, e := range m.entries {
+		entries[id] = e
+	}
+	m.mu.RUnlock()
+	ids := make([]string, 0, len(entries))
+	for id, e := range entries {
+		e.mu.Lock()
+		if !e.deleted {
+			ids = append(ids, id)
+		}
+		e.mu.Unlock()
+	}
+	return ids
+}
+
+// whether player is part of any live item
+func (m *Manager[T]) HasPlayer(player string) bool {
+	m.mu.RLock()
+	entries := make([]*entry[T], 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	m.mu.RUnlock()
+	for _, e := range entries {
+		e.mu.Lock()
+		found := !e.deleted && utils.Contains(e.item.GetPlayers(), player)
+		e.mu.Unlock()
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// add an item only if no item with the same ID exists; returns false if one does
+func (m *Manager[T]) Insert(item T) bool {
+	return m.write(item, false)
+}
+
+// add an item, or replace it if one with the same ID exists, and notify subscribers
+func (m *Manager[T]) Put(item T) {
+	m.write(item, true)
+}
+
+// atomically read, modify, and write back an item
+// if update returns an error, the stored item is left unchanged and the error is returned
+// update must not call back into the same manager for the same item
+func (m *Manager[T]) Update(id string, update func(*T) error) error {
+	e, exists := m.getEntry(id)
 	if !exists {
-		return fmt.Errorf("Attempted to subscribe to an item, %s, that doesn't exist", id)
+		return ItemNotFound{id}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.deleted {
+		return ItemNotFound{id}
+	}
+	item := e.item
+	if err := update(&item); err != nil {
+		return err
+	}
+	e.set(item)
+	m.markDirty(id)
+	return nil
+}
+
+// remove an item and tell subscribers why; returns false if the item didn't exist
+func (m *Manager[T]) Delete(id string, code CloseCode) bool {
+	e, exists := m.getEntry(id)
+	if !exists {
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.deleted {
+		return false
+	}
+	e.deleted = true
+	e.seq++
+	e.closed = closeEvent{e.seq, code}
+	for _, s := range e.subs {
+		s.close <- e.closed
+	}
+	e.subs = make(map[string]*Subscription[T])
+	m.markDirty(id)
+
+	time.AfterFunc(TOMBSTONE_TTL, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.entries[id] == e {
+			delete(m.entries, id)
+		}
+	})
+	return true
+}
+
+// the last event id the client saw, from the header EventSource sends when reconnecting,
+// or from a query parameter for clients opening a fresh stream; -1 if neither is given
+func lastEventID(c *fiber.Ctx) int {
+	header := c.Get("Last-Event-ID", c.Query("lastEventId"))
+	id, err := strconv.Atoi(header)
+	if err != nil {
+		return -1
+	}
+	return id
+}
+
+func writeCloseEvent(w *bufio.Writer, ev closeEvent) {
+	if ev.code == ContinueCode {
+		log.Printf("Notifying of continue signal")
+		fmt.Fprintf(w, "id: %d\nevent: continue\ndata: %d\n\n", ev.id, ev.code)
+	} else {
+		log.Printf("Notifying of deletion signal; code = %v", ev.code)
+		fmt.Fprintf(w, "id: %d\nevent: delete\ndata: %d\n\n", ev.id, ev.code)
+	}
+}
+
+// one subscriber's connection to an item, independent of how events reach the client
+// it starts with the events the client missed since lastID, or else the current version,
+// and a recently deleted item sends its continue/delete event straight away
+// timer fires when the next held event is due; the stream's loop should then call wake
+type stream[T utils.Manageable] struct {
+	manager    *Manager[T]
+	entry      *entry[T]
+	subscriber string
+	sub        *Subscription[T]
+	backlog    []event[T]
+	sent       int        // id of the last event sent, or of the last one the client saw if it can be caught up
+	pending    []event[T] // events held back from a spectator until they're old enough
+	timer      *time.Timer
+}
+
+func (m *Manager[T]) open(id string, subscriber string, lastID int) (*stream[T], error) {
+	e, exists := m.getEntry(id)
+	if !exists {
+		return nil, fmt.Errorf("Attempted to subscribe to an item, %s, that doesn't exist", id)
+	}
+	sub := makeSubscription[T]()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// the backlog always goes out, even if the client claims to be up to date
+	s := &stream[T]{manager: m, entry: e, subscriber: subscriber, sub: sub, backlog: e.since(lastID), sent: -1}
+	if e.canReplay(lastID) {
+		// the client has everything up to lastID, so only what came after is sent
+		s.sent = lastID
+	}
+	if len(e.history) != 0 && s.delay(e.history[0]) > 0 {
+		// a delayed spectator needs to start from an older version
+		s.backlog = append([]event[T]{}, e.history...)
+	}
+	if e.deleted {
+		sub.close <- e.closed
+	} else {
+		if old, exists := e.subs[subscriber]; exists {
+			old.close <- closeEvent{-1, ReplacedCode}
+		}
+		e.subs[subscriber] = sub
+		e.setConnected(subscriber, true)
+	}
+	// nothing is held yet; schedule arms the timer once something is
+	s.timer = time.NewTimer(HEARTBEAT_INTVL)
+	s.timer.Stop()
+	return s, nil
+}
+
+func (s *stream[T]) close() {
+	s.timer.Stop()
+	s.manager.unsubscribe(s.entry, s.subscriber, s.sub)
+}
+
+// how long ev must be held back from this subscriber
+func (s *stream[T]) delay(ev event[T]) time.Duration {
+	if utils.Contains(ev.item.GetPlayers(), s.subscriber) {
+		return 0
+	}
+	if w, ok := any(ev.item).(utils.Watchable); ok {
+		return w.SpectatorDelay()
+	}
+	return 0
+}
+
+// queue the backlog, returning whatever can be sent right away
+func (s *stream[T]) start() []event[T] {
+	s.pending = append(s.pending, s.backlog...)
+	ready := s.take()
+	if s.sent < 0 && len(ready) > 1 {
+		// a client that can't be caught up just gets the current version
+		ready = ready[len(ready)-1:]
+	}
+	return ready
+}
+
+// queue an event, returning whatever can be sent right away
+func (s *stream[T]) push(ev event[T]) []event[T] {
+	s.pending = append(s.pending, ev)
+	return s.take()
+}
+
+// called when the timer fires, returning the held events that are now due
+func (s *stream[T]) wake() []event[T] {
+	return s.take()
+}
+
+func (s *stream[T]) take() []event[T] {
+	ready := s.ready()
+	s.schedule()
+	return ready
+}
+
+// take the held events that are now due, oldest first
+func (s *stream[T]) ready() []event[T] {
+	now := time.Now()
+	n := 0
+	for n < len(s.pending) && !s.pending[n].at.Add(s.delay(s.pending[n])).After(now) {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	ready := s.pending[:n:n]
+	s.pending = s.pending[n:]
+	return ready
+}
+
+// set the timer for when the next held event is due, or stop it if nothing is held
+func (s *stream[T]) schedule() {
+	if !s.timer.Stop() {
+		// drain a fire that wasn't read, so it isn't mistaken for the new deadline
+		select {
+		case <-s.timer.C:
+		default:
+		}
+	}
+	if len(s.pending) != 0 {
+		next := s.pending[0]
+		s.timer.Reset(time.Until(next.at.Add(s.delay(next))))
+	}
+}
+
+// the subscriber's view of ev, or false if there's nothing new to send them
+func (s *stream[T]) render(ev event[T]) ([]byte, bool) {
+	if ev.id <= s.sent {
+		return nil, false
+	}
+	// spectators get -1
+	playerIndex := utils.IndexOf(ev.item.GetPlayers(), s.subscriber)
+	data, err := json.Marshal(ev.item.Visible(playerIndex))
+	if err != nil {
+		log.Println("Got error when processing stream notification:", err)
+		return nil, false
+	}
+	s.sent = ev.id
+	return data, true
+}
+
+// stream updates to an item as server-sent events
+func (m *Manager[T]) Subscribe(id string, subscriber string, c *fiber.Ctx) error {
+	s, err := m.open(id, subscriber, lastEventID(c))
+	if err != nil {
+		return err
 	}
-	sub := Subscription[T]{make(chan T), make(chan CloseCode)}
-	m.subs[id][subscriber] = sub
 
 	c.Set("Content-Type", "text/event-stream")
 	c.Set("Cache-Control", "no-cache")
@@ -72,30 +500,41 @@ func (m *Manager[T]) Subscribe(id string, subscriber string, c *fiber.Ctx) error
 	c.Set("Transfer-Encoding", "chunked")
 
 	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer s.close()
+		writeEvent := func(ev event[T]) {
+			if data, ok := s.render(ev); ok {
+				fmt.Fprintf(w, "id: %d\nevent: update\ndata: %s\n\n", ev.id, data)
+			}
+		}
+		for _, ev := range s.start() {
+			writeEvent(ev)
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("Error while flushing: %v. Closing stream.", err)
+			return
+		}
+
+		heartbeat := time.NewTicker(HEARTBEAT_INTVL)
+		defer heartbeat.Stop()
 		for {
 			select {
-			case item := <-sub.data:
-				playerIndex := utils.IndexOf(item.GetPlayers(), subscriber)
-				if playerIndex == -1 {
-					log.Println("When processing stream, subscriber is not in subscribed item")
-					break
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case <-s.timer.C:
+				for _, ev := range s.wake() {
+					writeEvent(ev)
 				}
-				data, err := json.Marshal(item.Visible(playerIndex))
-				if err != nil {
-					log.Println("Got error when processing stream notification:", err)
-					break
+			case ev := <-s.sub.data:
+				for _, ev := range s.push(ev) {
+					writeEvent(ev)
 				}
-				msg := fmt.Sprintf("event: update\ndata: %s\n\n", data)
-				log.Printf("Sending message:\n%v", msg)
-				fmt.Fprintf(w, msg)
-			case code := <-sub.close:
-				if code == ContinueCode {
-					log.Printf("Notifying of continue signal")
-					fmt.Fprintf(w, "event: continue\ndata: %d\n\n", code)
-				} else {
-					log.Printf("Notifying of deletion signal; code = %v", code)
-					fmt.Fprintf(w, "event: delete\ndata: %d\n\n", code)
+			case ev := <-s.sub.close:
+				if ev.code == ReplacedCode {
+					w.Flush()
+					return
 				}
+				writeCloseEvent(w, ev)
+				w.Flush()
 				return
 			}
 			err := w.Flush()
@@ -109,17 +548,65 @@ func (m *Manager[T]) Subscribe(id string, subscriber string, c *fiber.Ctx) error
 	return nil
 }
 
+// remove sub from e once its stream has ended, unless the subscriber has since opened a newer one
+func (m *Manager[T]) unsubscribe(e *entry[T], subscriber string, sub *Subscription[T]) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.subs[subscriber] == sub {
+		delete(e.subs, subscriber)
+		if !e.deleted {
+			e.setConnected(subscriber, false)
+		}
+	}
+}
+
+// stop sending updates to subscriber and close their stream
 func (m *Manager[T]) Unsubscribe(id string, subscriber string) {
-	_, exists := m.subs[id]
+	e, exists := m.getEntry(id)
 	if !exists {
 		return
 	}
-	delete(m.subs[id], subscriber)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if sub, exists := e.subs[subscriber]; exists {
+		e.seq++
+		sub.close <- closeEvent{e.seq, EmptyCode}
+		delete(e.subs, subscriber)
+	}
+}
+
+// whether the user may subscribe to item, as a player or (if the item allows it) as a spectator
+func canWatch(item utils.Manageable, authInfo JWTPayload) bool {
+	if authInfo.Admin || utils.Contains(item.GetPlayers(), authInfo.Name) {
+		return true
+	}
+	w, ok := item.(utils.Watchable)
+	return ok && w.AllowsSpectators()
+}
+
+// status code and message for an error from Manager.Update (or the update function passed to it)
+// update functions can return a *fiber.Error to choose the status code
+func errorStatus(err error) (int, string) {
+	switch e := err.(type) {
+	case ItemNotFound:
+		return fiber.StatusNotFound, e.Error()
+	case *fiber.Error:
+		return e.Code, e.Message
+	default:
+		return fiber.StatusInternalServerError, err.Error()
+	}
+}
+
+// write an error from Manager.Update as a response
+func sendUpdateError(c *fiber.Ctx, err error) error {
+	status, msg := errorStatus(err)
+	c.Context().SetStatusCode(status)
+	return c.SendString(msg)
 }
 
-func MakeManager[T utils.Manageable]() Manager[T] {
-	return Manager[T]{
-		items: make(map[string]T),
-		subs:  make(map[string]map[string]Subscription[T]),
+func MakeManager[T utils.Manageable]() *Manager[T] {
+	return &Manager[T]{
+		entries: make(map[string]*entry[T]),
+		dirty:   make(map[string]bool),
 	}
 }
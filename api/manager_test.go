@@ -0,0 +1,240 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type counter struct {
+	ID      string
+	Players []string
+	N       int
+}
+
+func (c counter) GetID() string {
+	return c.ID
+}
+
+func (c counter) GetPlayers() []string {
+	return c.Players
+}
+
+func (c counter) Visible(int) interface{} {
+	return c
+}
+
+func increment(c *counter) error {
+	c.N++
+	return nil
+}
+
+func TestManagerConcurrentUpdates(t *testing.T) {
+	m := MakeManager[counter]()
+	const workers, updates = 20, 200
+	for i := 0; i < 4; i++ {
+		m.Put(counter{ID: fmt.Sprint(i), Players: []string{fmt.Sprint("p", i)}})
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			id := fmt.Sprint(w % 4)
+			for i := 0; i < updates; i++ {
+				if err := m.Update(id, increment); err != nil {
+					t.Error(err)
+					return
+				}
+				// readers of the same and other items shouldn't see torn state or block updates
+				m.Get(id)
+				m.Get("3")
+				m.IDs()
+			}
+		}(w)
+	}
+	wg.Wait()
+	for i := 0; i < 4; i++ {
+		c, _ := m.Get(fmt.Sprint(i))
+		if c.N != workers/4*updates {
+			t.Errorf("item %d was incremented %d times, expected %d", i, c.N, workers/4*updates)
+		}
+	}
+}
+
+func TestManagerInsertAndDelete(t *testing.T) {
+	m := MakeManager[counter]()
+	if !m.Insert(counter{ID: "a", N: 1}) {
+		t.Fatal("couldn't insert into an empty manager")
+	}
+	if m.Insert(counter{ID: "a", N: 2}) {
+		t.Fatal("insert replaced a live item")
+	}
+	if c, _ := m.Get("a"); c.N != 1 {
+		t.Fatalf("item is %+v after a failed insert", c)
+	}
+	if !m.Delete("a", EmptyCode) {
+		t.Fatal("couldn't delete a live item")
+	}
+	if m.Delete("a", EmptyCode) {
+		t.Fatal("deleted the same item twice")
+	}
+	if _, ok := m.Update("a", increment).(ItemNotFound); !ok {
+		t.Fatal("updated a deleted item")
+	}
+	if _, exists := m.Get("a"); exists {
+		t.Fatal("got a deleted item")
+	}
+	if _, exists := m.GetRecent("a"); !exists {
+		t.Fatal("recently deleted item was forgotten")
+	}
+	if !m.Insert(counter{ID: "a", N: 3}) {
+		t.Fatal("couldn't insert in place of a deleted item")
+	}
+	if c, _ := m.Get("a"); c.N != 3 {
+		t.Fatalf("item is %+v after inserting it again", c)
+	}
+	if ids := m.IDs(); len(ids) != 1 || ids[0] != "a" {
+		t.Fatalf("IDs are %v, expected [a]", ids)
+	}
+}
+
+func TestManagerFailedUpdate(t *testing.T) {
+	m := MakeManager[counter]()
+	m.Put(counter{ID: "a", Players: []string{"p"}})
+	err := m.Update("a", func(c *counter) error {
+		c.N = 100
+		c.Players = nil
+		return fmt.Errorf("changed my mind")
+	})
+	if err == nil {
+		t.Fatal("update error was dropped")
+	}
+	if c, _ := m.Get("a"); c.N != 0 || len(c.Players) != 1 {
+		t.Fatalf("failed update was kept: %+v", c)
+	}
+}
+
+// versions of the counter sent to a client resuming after lastID
+func backlogValues(m *Manager[counter], lastID int) []int {
+	s, err := m.open("a", "p", lastID)
+	if err != nil {
+		panic(err)
+	}
+	defer s.close()
+	values := []int{}
+	for _, ev := range s.start() {
+		if _, ok := s.render(ev); ok {
+			values = append(values, ev.item.N)
+		}
+	}
+	return values
+}
+
+func TestManagerReplay(t *testing.T) {
+	m := MakeManager[counter]()
+	m.Put(counter{ID: "a", Players: []string{"p"}})
+	for i := 0; i < 5; i++ {
+		m.Update("a", increment)
+	}
+	// events are numbered from 1, so event i holds N = i-1
+	tests := []struct {
+		lastID int
+		want   []int
+	}{
+		{-1, []int{5}},
+		{3, []int{3, 4, 5}},
+		{0, []int{0, 1, 2, 3, 4, 5}},
+		// already up to date, or from the future; gets the latest to be safe
+		{6, []int{5}},
+		{10, []int{5}},
+	}
+	for _, test := range tests {
+		if got := backlogValues(m, test.lastID); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("resuming from %d replayed %v, expected %v", test.lastID, got, test.want)
+		}
+	}
+
+	for i := 0; i < REPLAY_BUFFER_SIZE; i++ {
+		m.Update("a", increment)
+	}
+	if got := backlogValues(m, 3); len(got) != 1 || got[0] != 5+REPLAY_BUFFER_SIZE {
+		t.Errorf("resuming from an event that's no longer kept replayed %v, expected just the latest", got)
+	}
+}
+
+func TestManagerSubscriberGetsLatest(t *testing.T) {
+	m := MakeManager[counter]()
+	m.Put(counter{ID: "a", Players: []string{"p"}})
+	sub := makeSubscription[counter]()
+	e, _ := m.getEntry("a")
+	e.mu.Lock()
+	e.subs["p"] = sub
+	e.mu.Unlock()
+	var wg sync.WaitGroup
+	for w := 0; w < 10; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				m.Update("a", increment)
+			}
+		}()
+	}
+	wg.Wait()
+	// a slow subscriber only holds on to the newest version
+	if ev := <-sub.data; ev.item.N != 1000 {
+		t.Errorf("subscriber's pending update has N = %d, expected 1000", ev.item.N)
+	}
+
+	m.Delete("a", ContinueCode)
+	if ev := <-sub.close; ev.code != ContinueCode {
+		t.Errorf("subscriber was closed with %v, expected ContinueCode", ev.code)
+	}
+}
+
+// a counter that spectators see after a delay
+type delayed struct {
+	counter
+}
+
+func (d delayed) AllowsSpectators() bool {
+	return true
+}
+
+func (d delayed) SpectatorDelay() time.Duration {
+	return time.Millisecond * 50
+}
+
+func TestManagerSpectatorDelay(t *testing.T) {
+	m := MakeManager[delayed]()
+	m.Put(delayed{counter{ID: "a", Players: []string{"p"}}})
+	s, err := m.open("a", "spectator", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if ready := s.start(); len(ready) != 0 {
+		t.Fatalf("spectator was sent %d events before the delay", len(ready))
+	}
+	m.Update("a", func(d *delayed) error { d.N++; return nil })
+	if ready := s.push(<-s.sub.data); len(ready) != 0 {
+		t.Fatalf("spectator was sent %d events before the delay", len(ready))
+	}
+	// the timer goes off for the first held version, and whatever is due by then is sent in order
+	values := []int{}
+	for len(values) < 2 {
+		select {
+		case <-s.timer.C:
+			for _, ev := range s.wake() {
+				values = append(values, ev.item.N)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timer didn't fire for held events; got %v", values)
+		}
+	}
+	if fmt.Sprint(values) != "[0 1]" {
+		t.Errorf("spectator was sent %v, expected [0 1]", values)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/game"
+)
+
+var matchManager = MakeManager[game.Match]()
+
+// start a multi-hand match from a lobby; replaces startBidding for lobbies that want a full match
+func startMatch(c *fiber.Ctx) error {
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	settings := struct {
+		Target int `json:"target"`
+		Limit  int `json:"limit"`
+	}{game.DEFAULT_MATCH_TARGET, game.DEFAULT_MATCH_LIMIT}
+	if len(c.Body()) != 0 {
+		if err := c.BodyParser(&settings); err != nil {
+			c.Context().SetStatusCode(fiber.StatusBadRequest)
+			return c.SendString(fmt.Sprintf("When parsing match settings, got error %v", err))
+		}
+	}
+
+	matchID := c.Params("matchid")
+	lobby, exists := lobbyManager.Get(matchID)
+	if !exists {
+		c.Context().SetStatusCode(fiber.StatusNotFound)
+		return c.SendString("When starting match, attempted to fetch a lobby that doesn't exist")
+	}
+	if lobby.Host != authInfo.Name {
+		c.Context().SetStatusCode(fiber.StatusForbidden)
+		return c.SendString("You must be the lobby host to start a match")
+	}
+	if err := checkRanked(authInfo, lobby.Ranked); err != nil {
+		return sendUpdateError(c, err)
+	}
+	match, err := game.MakeMatch(lobby, settings.Target, settings.Limit)
+	if err != nil {
+		c.Context().SetStatusCode(fiber.StatusBadRequest)
+		return c.SendString(fmt.Sprintf("When creating match, got error %v", err))
+	}
+	bidState, err := match.NextHand()
+	if err != nil {
+		c.Context().SetStatusCode(fiber.StatusInternalServerError)
+		return c.SendString(fmt.Sprintf("When dealing first hand of match, got error %v", err))
+	}
+
+	if !matchManager.Insert(match) {
+		c.Context().SetStatusCode(fiber.StatusConflict)
+		return c.SendString("A match with this ID has already started")
+	}
+	if !bidManager.Insert(bidState) {
+		// a single game was started from the lobby first
+		matchManager.Delete(matchID, EmptyCode)
+		c.Context().SetStatusCode(fiber.StatusConflict)
+		return c.SendString("Bidding has already started for this game")
+	}
+	lobbyManager.Delete(matchID, ContinueCode)
+	startBidBots(matchID)
+
+	return c.JSON(match)
+}
+
+func getMatchState(c *fiber.Ctx) error {
+	matchID := c.Params("matchid")
+	match, exists := matchManager.Get(matchID)
+	if !exists {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return c.JSON(match)
+}
+
+// deal the next hand once the previous one is finished
+func nextHand(c *fiber.Ctx) error {
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	matchID := c.Params("matchid")
+	var bidState game.BidState
+	err = matchManager.Update(matchID, func(match *game.Match) error {
+		if !match.HasPlayer(authInfo.Name) {
+			return fiber.ErrForbidden
+		}
+		b, err := match.NextHand()
+		if err != nil {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("When starting next hand, got error %v", err))
+		}
+		bidState = b
+		return nil
+	})
+	if err != nil {
+		return sendUpdateError(c, err)
+	}
+	bidManager.Put(bidState)
+	gameManager.Delete(matchID, ContinueCode)
+	startBidBots(matchID)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// if the game is one hand of a match, add its score to the match
+func recordMatchHand(gameState game.GameState) error {
+	if !gameState.Done {
+		return nil
+	}
+	err := matchManager.Update(gameState.ID, func(match *game.Match) error {
+		return match.RecordHand(gameState)
+	})
+	if _, ok := err.(ItemNotFound); ok {
+		return nil
+	}
+	return err
+}
+
+func subscribeToMatch(c *fiber.Ctx) error {
+	matchID := c.Params("matchid")
+	match, exists := matchManager.GetRecent(matchID)
+	if !exists {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	authInfo, err := getAuthInfo(c)
+	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	// require player to be member of match (or the match to allow spectators) in order to subscribe
+	if !canWatch(match, authInfo) {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	err = matchManager.Subscribe(matchID, authInfo.Name, c)
+	if err != nil {
+		log.Println("When subscribing to match stream:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func setupMatches(r fiber.Router) {
+	r.Put("/:matchid", startMatch)
+	r.Get("/:matchid", getMatchState)
+	r.Post("/:matchid/next", nextHand)
+	r.Get("/:matchid/subscribe", subscribeToMatch)
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/db"
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// every request is authenticated once, by authenticate, and handlers get the result from getAuthInfo
+// credentials can be the jwt cookie set at login, or an "Authorization: Bearer" header holding either
+// an access token or an api token
+
+const AUTH_LOCALS_KEY = "auth"
+
+type authResult struct {
+	info JWTPayload
+	err  error
+}
+
+type InvalidAPIToken struct{}
+
+func (InvalidAPIToken) Error() string {
+	return "API token is invalid, expired or revoked"
+}
+
+func checkAPIToken(raw string) (JWTPayload, error) {
+	id, secret, ok := db.ParseAPIToken(raw)
+	if !ok {
+		return JWTPayload{}, InvalidAPIToken{}
+	}
+	token, err := storage.GetAPIToken(id)
+	if _, notFound := err.(db.ItemNotFound); notFound {
+		return JWTPayload{}, InvalidAPIToken{}
+	}
+	if err != nil {
+		return JWTPayload{}, err
+	}
+	if !token.CheckSecret(secret) || token.Expired() {
+		return JWTPayload{}, InvalidAPIToken{}
+	}
+	// the scope only lasts as long as the owner is still an admin
+	admin := false
+	if utils.Contains(token.Scopes, SCOPE_ADMIN) {
+		user, err := storage.GetUser(token.User)
+		if _, notFound := err.(db.ItemNotFound); notFound {
+			return JWTPayload{}, InvalidAPIToken{}
+		}
+		if err != nil {
+			return JWTPayload{}, err
+		}
+		admin = user.Admin
+	}
+	return JWTPayload{
+		Name:       token.User,
+		Admin:      admin,
+		ExpireTime: token.Expires,
+		APIToken:   token.ID,
+		Scopes:     token.Scopes,
+	}, nil
+}
+
+func readCredentials(c *fiber.Ctx) (JWTPayload, error) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if header == "" {
+		return UnloadTokenCookie(c)
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return JWTPayload{}, fmt.Errorf("Authorization header must use the Bearer scheme")
+	}
+	if strings.HasPrefix(token, db.API_TOKEN_PREFIX) {
+		return checkAPIToken(token)
+	}
+	return parseAccessToken(token)
+}
+
+// requests without valid credentials are let through, since some routes don't need them
+func authenticate(c *fiber.Ctx) error {
+	info, err := readCredentials(c)
+	c.Locals(AUTH_LOCALS_KEY, authResult{info, err})
+	return c.Next()
+}
+
+// the credentials authenticate found for the request
+func getAuthInfo(c *fiber.Ctx) (JWTPayload, error) {
+	result, ok := c.Locals(AUTH_LOCALS_KEY).(authResult)
+	if !ok {
+		return JWTPayload{}, MissingToken{}
+	}
+	return result.info, result.err
+}
+
+// logins from the website can do anything; api tokens only what their scopes allow
+func (p JWTPayload) hasScope(scope string) bool {
+	return p.APIToken == "" || utils.Contains(p.Scopes, scope)
+}
+
+// turn away api tokens without the given scope from the rest of the group
+func requireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if authInfo, err := getAuthInfo(c); err == nil && !authInfo.hasScope(scope) {
+			c.Context().SetStatusCode(fiber.StatusForbidden)
+			return c.SendString(fmt.Sprintf("API token does not have the %s scope", scope))
+		}
+		return c.Next()
+	}
+}
+
+// turn away api tokens altogether, e.g. from account settings
+func requireSession(c *fiber.Ctx) error {
+	if authInfo, err := getAuthInfo(c); err == nil && authInfo.APIToken != "" {
+		c.Context().SetStatusCode(fiber.StatusForbidden)
+		return c.SendString("API tokens can't be used here; log in instead")
+	}
+	return c.Next()
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/db"
+	"golang.org/x/oauth2"
+)
+
+// players can sign in with an external OpenID Connect provider instead of a name and password
+// the flow is the authorization code flow with PKCE: /api/auth/oidc/login sends the player to the provider,
+// which sends them back to /api/auth/oidc/callback with a code that's exchanged for an id token
+// the first time someone signs in, a user is created for them and linked to their subject at the provider
+// set BIRD_OIDC_ISSUER to enable; `go run ./bin mockoidc` runs a provider for local testing
+const (
+	OIDC_ISSUER_ENV        = "BIRD_OIDC_ISSUER"
+	OIDC_CLIENT_ID_ENV     = "BIRD_OIDC_CLIENT_ID"
+	OIDC_CLIENT_SECRET_ENV = "BIRD_OIDC_CLIENT_SECRET"
+	// where the provider sends players back to, e.g. https://bird-game.fly.dev/api/auth/oidc/callback
+	OIDC_REDIRECT_URL_ENV = "BIRD_OIDC_REDIRECT_URL"
+	// shown on the login page, e.g. "Google"
+	OIDC_NAME_ENV = "BIRD_OIDC_NAME"
+)
+
+const OIDC_DISCOVERY_TIMEOUT time.Duration = time.Second * 10
+const OIDC_EXCHANGE_TIMEOUT time.Duration = time.Second * 10
+
+// state, nonce and PKCE verifier are kept in a cookie between the login redirect and the callback
+const OIDC_FLOW_COOKIE_NAME = "oidc_flow"
+const OIDC_FLOW_COOKIE_PATH = "/api/auth/oidc"
+const OIDC_FLOW_LIFETIME time.Duration = time.Minute * 10
+
+// number of tries to find an unused name for a new user
+const OIDC_NAME_ATTEMPTS = 5
+
+type oidcProvider struct {
+	name     string
+	verifier *oidc.IDTokenVerifier
+	config   oauth2.Config
+}
+
+// nil unless configured
+var oidcLogin *oidcProvider
+
+// fetch the provider's configuration, if one is set in the environment
+func loadOIDC() error {
+	issuer := os.Getenv(OIDC_ISSUER_ENV)
+	if issuer == "" {
+		return nil
+	}
+	clientID := os.Getenv(OIDC_CLIENT_ID_ENV)
+	redirectURL := os.Getenv(OIDC_REDIRECT_URL_ENV)
+	if clientID == "" || redirectURL == "" {
+		return fmt.Errorf("%s and %s must be set when %s is", OIDC_CLIENT_ID_ENV, OIDC_REDIRECT_URL_ENV, OIDC_ISSUER_ENV)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), OIDC_DISCOVERY_TIMEOUT)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return fmt.Errorf("Error when discovering OIDC provider %s: %v", issuer, err)
+	}
+	name := os.Getenv(OIDC_NAME_ENV)
+	if name == "" {
+		name = issuer
+	}
+	oidcLogin = &oidcProvider{
+		name:     name,
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv(OIDC_CLIENT_SECRET_ENV),
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+	}
+	log.Println("Signing in with OIDC provider", issuer)
+	return nil
+}
+
+type oidcFlow struct {
+	state    string
+	nonce    string
+	verifier string
+}
+
+func newOIDCFlow() (oidcFlow, error) {
+	values := make([]string, 3)
+	for i := range values {
+		value, err := db.RandomToken(32)
+		if err != nil {
+			return oidcFlow{}, err
+		}
+		values[i] = value
+	}
+	return oidcFlow{values[0], values[1], values[2]}, nil
+}
+
+// random tokens never contain '.'
+func (f oidcFlow) String() string {
+	return f.state + "." + f.nonce + "." + f.verifier
+}
+
+func parseOIDCFlow(s string) (oidcFlow, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return oidcFlow{}, false
+	}
+	return oidcFlow{parts[0], parts[1], parts[2]}, true
+}
+
+// S256 code challenge for the PKCE verifier
+func (f oidcFlow) challenge() string {
+	sum := sha256.Sum256([]byte(f.verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func setOIDCFlowCookie(c *fiber.Ctx, value string, maxAge int) {
+	c.Cookie(&fiber.Cookie{
+		Name:     OIDC_FLOW_COOKIE_NAME,
+		Value:    value,
+		MaxAge:   maxAge,
+		HTTPOnly: true,
+		Secure:   true,
+		Path:     OIDC_FLOW_COOKIE_PATH,
+		// the callback is a redirect from the provider's site, so the cookie can't be strict
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+type OIDCLoginFailed struct {
+	Reason string
+}
+
+func (e OIDCLoginFailed) Error() string {
+	return e.Reason
+}
+
+// the id token claims used to pick a name for a new user
+type oidcClaims struct {
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	Email             string `json:"email"`
+}
+
+// turn a name from the provider into something ValidateUserName accepts, or "" if there's not enough left
+func sanitizeName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == ' ':
+			b.WriteRune('_')
+		case r < 128 && db.NAME_PATTERN.MatchString(string(r)):
+			b.WriteRune(r)
+		}
+	}
+	sanitized := b.String()
+	// leave room for a suffix in case the name is taken
+	if len(sanitized) > db.MAX_NAME_LENGTH-5 {
+		sanitized = sanitized[:db.MAX_NAME_LENGTH-5]
+	}
+	if len(sanitized) < db.MIN_NAME_LENGTH || isGuestName(sanitized) {
+		return ""
+	}
+	return sanitized
+}
+
+// names to try for a new user, best first
+func (claims oidcClaims) nameCandidates() ([]string, error) {
+	emailName, _, _ := strings.Cut(claims.Email, "@")
+	base := ""
+	for _, name := range []string{claims.PreferredUsername, claims.Name, emailName} {
+		if base = sanitizeName(name); base != "" {
+			break
+		}
+	}
+	if base == "" {
+		base = "player"
+	}
+	candidates := []string{base}
+	for len(candidates) < OIDC_NAME_ATTEMPTS {
+		suffix, err := db.RandomToken(3)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, base+"-"+suffix)
+	}
+	return candidates, nil
+}
+
+// create a user for the identity, and link the two
+func createOIDCUser(identityID string, claims oidcClaims) (db.User, error) {
+	candidates, err := claims.nameCandidates()
+	if err != nil {
+		return db.User{}, err
+	}
+	user := db.User{Identity: identityID}
+	for _, name := range candidates {
+		user.Name = name
+		err = storage.PutUser(user)
+		if _, taken := err.(db.ItemAlreadyExists); !taken {
+			break
+		}
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+	err = storage.PutIdentity(db.Identity{ID: identityID, User: user.Name})
+	if _, linked := err.(db.ItemAlreadyExists); linked {
+		// a simultaneous sign-in got there first, so use the user it created
+		if err := storage.DeleteUser(user.Name); err != nil {
+			return db.User{}, err
+		}
+		identity, err := storage.GetIdentity(identityID)
+		if err != nil {
+			return db.User{}, err
+		}
+		return storage.GetUser(identity.User)
+	}
+	return user, err
+}
+
+// find the user linked to the identity, creating one if there isn't one yet
+func oidcUser(identityID string, claims oidcClaims) (db.User, error) {
+	identity, err := storage.GetIdentity(identityID)
+	if _, notFound := err.(db.ItemNotFound); notFound {
+		return createOIDCUser(identityID, claims)
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+	user, err := storage.GetUser(identity.User)
+	if err == nil && user.Identity == identityID {
+		return user, nil
+	}
+	if _, notFound := err.(db.ItemNotFound); err != nil && !notFound {
+		return db.User{}, err
+	}
+	// the linked user has been deleted, so start over
+	if err := storage.DeleteIdentity(identityID); err != nil {
+		return db.User{}, err
+	}
+	return createOIDCUser(identityID, claims)
+}
+
+// check the callback against the flow it belongs to, and exchange its code for the signed-in user
+func (p *oidcProvider) callback(c *fiber.Ctx, flow oidcFlow) (db.User, error) {
+	if e := c.Query("error"); e != "" {
+		return db.User{}, OIDCLoginFailed{fmt.Sprintf("Sign in was refused: %s", e)}
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(flow.state)) != 1 {
+		return db.User{}, OIDCLoginFailed{"Sign in expired or was started elsewhere; please try again"}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), OIDC_EXCHANGE_TIMEOUT)
+	defer cancel()
+	token, err := p.config.Exchange(ctx, c.Query("code"), oauth2.SetAuthURLParam("code_verifier", flow.verifier))
+	if err != nil {
+		return db.User{}, fmt.Errorf("Error when exchanging OIDC code: %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return db.User{}, fmt.Errorf("OIDC token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return db.User{}, fmt.Errorf("Error when verifying OIDC id token: %v", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(flow.nonce)) != 1 {
+		return db.User{}, fmt.Errorf("OIDC id token has the wrong nonce")
+	}
+	claims := oidcClaims{}
+	if err := idToken.Claims(&claims); err != nil {
+		return db.User{}, fmt.Errorf("Error when reading OIDC claims: %v", err)
+	}
+	return oidcUser(db.IdentityID(idToken.Issuer, idToken.Subject), claims)
+}
+
+// tells the login page whether to offer signing in with a provider
+func oidcInfoHandler(c *fiber.Ctx) error {
+	if oidcLogin == nil {
+		return c.JSON(fiber.Map{"enabled": false})
+	}
+	return c.JSON(fiber.Map{"enabled": true, "name": oidcLogin.name})
+}
+
+func oidcLoginHandler(c *fiber.Ctx) error {
+	if oidcLogin == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	flow, err := newOIDCFlow()
+	if err != nil {
+		log.Println("When starting OIDC login:", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	setOIDCFlowCookie(c, flow.String(), int(OIDC_FLOW_LIFETIME.Seconds()))
+	return c.Redirect(oidcLogin.config.AuthCodeURL(
+		flow.state,
+		oidc.Nonce(flow.nonce),
+		oauth2.SetAuthURLParam("code_challenge", flow.challenge()),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	))
+}
+
+// the provider sends the player here; they end up back on the site, logged in or on the login page with an error
+func oidcCallbackHandler(c *fiber.Ctx) error {
+	if oidcLogin == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	flowCookie := c.Cookies(OIDC_FLOW_COOKIE_NAME)
+	// each flow can only be used once
+	setOIDCFlowCookie(c, "", -1)
+	flow, ok := parseOIDCFlow(flowCookie)
+	var user db.User
+	var err error
+	if !ok {
+		err = OIDCLoginFailed{"Sign in expired or was started elsewhere; please try again"}
+	} else {
+		user, err = oidcLogin.callback(c, flow)
+	}
+	if err == nil {
+		_, err = startSession(c, user)
+	}
+	if err != nil {
+		reason := "Something went wrong when signing in"
+		if e, ok := err.(OIDCLoginFailed); ok {
+			reason = e.Reason
+		} else {
+			log.Println("When completing OIDC login:", err)
+		}
+		return c.Redirect("/login?error=" + url.QueryEscape(reason))
+	}
+	return c.Redirect("/")
+}
@@ -11,21 +11,46 @@ import (
 const CACHE_UPDATE_INTVL time.Duration = time.Millisecond * 500
 const CACHE_FLUSH_INTVL time.Duration = time.Second * 30
 
-var tables *db.Tables
-
-func InitApi(r fiber.Router, t *db.Tables) error {
-	tables = t
+var storage db.Storage
+
+func InitApi(r fiber.Router, s db.Storage) error {
+	if s == nil {
+		return fmt.Errorf("No storage provided")
+	}
+	storage = s
+	if err := loadJWTKeys(); err != nil {
+		return err
+	}
+	if err := loadLoginLimits(); err != nil {
+		return err
+	}
+	if err := loadOIDC(); err != nil {
+		return err
+	}
+	if err := loadBots(); err != nil {
+		return err
+	}
+	if err := persistManagers(storage); err != nil {
+		return fmt.Errorf("Error restoring live games: %v", err)
+	}
+	resumeBots()
+	if err := initDenylist(); err != nil {
+		return err
+	}
 	r.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("Bird backend")
 	})
 
-	setupAuth(r.Group("/auth"))
-	setupLobbies(r.Group("/lobbies"))
-	setupBidding(r.Group("/bidding"))
-	setupGames(r.Group("/games"))
+	r.Use(authenticate)
+	setupAuth(r.Group("/auth", requireSession))
+	setupLobbies(r.Group("/lobbies", requireScope(SCOPE_PLAY)))
+	setupBidding(r.Group("/bidding", requireScope(SCOPE_PLAY)))
+	setupGames(r.Group("/games", requireScope(SCOPE_PLAY)))
+	setupMatches(r.Group("/matches", requireScope(SCOPE_PLAY)))
+	setupAdmin(r.Group("/admin", requireScope(SCOPE_ADMIN)))
 
 	r.Get("/login/testAuth", func(c *fiber.Ctx) error {
-		authInfo, err := UnloadTokenCookie(c)
+		authInfo, err := getAuthInfo(c)
 		if err != nil {
 			return c.SendString(fmt.Sprintf("Got error when unloading cookie: %v", err))
 		}
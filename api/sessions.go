@@ -0,0 +1,195 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/db"
+)
+
+// how often the denylist is re-read from storage, to pick up tokens revoked elsewhere, e.g. by the cli
+const DENYLIST_SYNC_INTVL time.Duration = time.Second * 30
+
+// access tokens that have been revoked before expiring
+// kept in memory, since it's checked on every request
+type denylist struct {
+	mu     sync.RWMutex
+	tokens map[string]int64 // jti -> expiry
+}
+
+var deniedTokens = denylist{tokens: make(map[string]int64)}
+
+func (d *denylist) add(token db.DeniedToken) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tokens[token.JTI] = token.Expires
+}
+
+func (d *denylist) contains(jti string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, denied := d.tokens[jti]
+	return denied
+}
+
+// replace the local denylist with the one in storage
+func (d *denylist) sync() error {
+	tokens, err := storage.DeniedTokens()
+	if err != nil {
+		return err
+	}
+	newTokens := make(map[string]int64, len(tokens))
+	for _, t := range tokens {
+		newTokens[t.JTI] = t.Expires
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// keep anything denied locally since the read began
+	now := time.Now().Unix()
+	for jti, expires := range d.tokens {
+		if expires > now {
+			if _, exists := newTokens[jti]; !exists {
+				newTokens[jti] = expires
+			}
+		}
+	}
+	d.tokens = newTokens
+	return nil
+}
+
+func initDenylist() error {
+	if err := deniedTokens.sync(); err != nil {
+		return fmt.Errorf("Error loading token denylist: %v", err)
+	}
+	go func() {
+		for range time.Tick(DENYLIST_SYNC_INTVL) {
+			if err := deniedTokens.sync(); err != nil {
+				log.Println("When syncing token denylist:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// deny an access token for the rest of its lifetime
+func denyToken(jti string, expires int64) error {
+	if jti == "" || expires <= time.Now().Unix() {
+		return nil
+	}
+	token := db.DeniedToken{JTI: jti, Expires: expires}
+	if err := storage.DenyToken(token); err != nil {
+		return err
+	}
+	deniedTokens.add(token)
+	return nil
+}
+
+// the db helpers put a revoked session's access token on the stored denylist; this adds it to ours as well
+func denyRevokedSession(session db.Session) {
+	if session.AccessJTI != "" {
+		deniedTokens.add(db.DeniedToken{JTI: session.AccessJTI, Expires: session.AccessExpires})
+	}
+}
+
+func revokeSession(session db.Session) error {
+	if err := db.RevokeSession(storage, session); err != nil {
+		return err
+	}
+	denyRevokedSession(session)
+	return nil
+}
+
+// end all of user's sessions; returns the number revoked
+func revokeUserSessions(user string) (int, error) {
+	revoked, err := db.RevokeUserSessions(storage, user)
+	for _, session := range revoked {
+		denyRevokedSession(session)
+	}
+	return len(revoked), err
+}
+
+// start a new session for user and log them in to it
+func startSession(c *fiber.Ctx, user db.User) (JWTPayload, error) {
+	session, refreshToken, err := db.NewSession(user.Name, REFRESH_TOKEN_LIFETIME)
+	if err != nil {
+		return JWTPayload{}, err
+	}
+	return setTokenCookies(c, user, &session, refreshToken)
+}
+
+// held while rotating refresh tokens, so a token can't be used twice by racing requests
+var refreshMu sync.Mutex
+
+type InvalidRefreshToken struct {
+	Reason string
+}
+
+func (e InvalidRefreshToken) Error() string {
+	return "Invalid refresh token: " + e.Reason
+}
+
+// swap the request's refresh token for a new one, and issue a new access token
+func refreshSession(c *fiber.Ctx) (JWTPayload, error) {
+	id, secret, ok := db.ParseRefreshToken(c.Cookies(REFRESH_COOKIE_NAME))
+	if !ok {
+		return JWTPayload{}, InvalidRefreshToken{"missing or malformed"}
+	}
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+	session, err := storage.GetSession(id)
+	if err != nil {
+		if _, ok := err.(db.ItemNotFound); ok {
+			return JWTPayload{}, InvalidRefreshToken{"no such session"}
+		}
+		return JWTPayload{}, err
+	}
+	if session.Expired() {
+		storage.DeleteSession(session.ID)
+		return JWTPayload{}, InvalidRefreshToken{"session expired"}
+	}
+	if !session.CheckRefresh(secret) {
+		// an old refresh token being used again means it may have been stolen, so end the session
+		log.Printf("Refresh token reused for session of %s; revoking session", session.User)
+		if err := revokeSession(session); err != nil {
+			return JWTPayload{}, err
+		}
+		return JWTPayload{}, InvalidRefreshToken{"token already used"}
+	}
+	user, err := storage.GetUser(session.User)
+	if err != nil {
+		if _, ok := err.(db.ItemNotFound); ok {
+			revokeSession(session)
+			return JWTPayload{}, InvalidRefreshToken{"user no longer exists"}
+		}
+		return JWTPayload{}, err
+	}
+	// only the newest access token for a session is valid
+	if err := denyToken(session.AccessJTI, session.AccessExpires); err != nil {
+		return JWTPayload{}, err
+	}
+	refreshToken, err := session.Rotate(REFRESH_TOKEN_LIFETIME)
+	if err != nil {
+		return JWTPayload{}, err
+	}
+	return setTokenCookies(c, user, &session, refreshToken)
+}
+
+// the session the request belongs to, identified by its refresh token or else its access token
+func currentSession(c *fiber.Ctx) (db.Session, bool) {
+	if id, secret, ok := db.ParseRefreshToken(c.Cookies(REFRESH_COOKIE_NAME)); ok {
+		session, err := storage.GetSession(id)
+		if err == nil && session.CheckRefresh(secret) {
+			return session, true
+		}
+	}
+	if authInfo, err := getAuthInfo(c); err == nil && authInfo.Session != "" {
+		session, err := storage.GetSession(authInfo.Session)
+		if err == nil && session.User == authInfo.Name {
+			return session, true
+		}
+	}
+	return db.Session{}, false
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/quevivasbien/bird-game/db"
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// snapshots older than this when the server starts are thrown out rather than restored
+const SNAPSHOT_MAX_AGE time.Duration = time.Hour * 24
+
+// what gets saved for each item; Seq lets event ids keep increasing after a restart
+type snapshot[T utils.Manageable] struct {
+	Seq  int `json:"seq"`
+	Item T   `json:"item"`
+}
+
+// restore items of the given kind from store, then keep store up to date with changes,
+// saving every CACHE_UPDATE_INTVL
+func (m *Manager[T]) Persist(kind string, store db.SnapshotStore) error {
+	m.kind = kind
+	m.store = store
+	if err := m.restore(); err != nil {
+		return err
+	}
+	go func() {
+		for range time.Tick(CACHE_UPDATE_INTVL) {
+			m.Flush()
+		}
+	}()
+	return nil
+}
+
+func (m *Manager[T]) restore() error {
+	snapshots, err := m.store.LoadSnapshots(m.kind)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	restored := 0
+	for _, s := range snapshots {
+		if time.Since(time.Unix(s.Updated, 0)) > SNAPSHOT_MAX_AGE {
+			if err := m.store.DeleteSnapshot(m.kind, s.ID); err != nil {
+				log.Printf("When deleting old %s snapshot %s, got error %v", m.kind, s.ID, err)
+			}
+			continue
+		}
+		saved := snapshot[T]{}
+		if err := json.Unmarshal([]byte(s.Data), &saved); err != nil {
+			log.Printf("Skipping %s snapshot %s, which could not be read: %v", m.kind, s.ID, err)
+			continue
+		}
+		// nobody was connected when the server went down
+		if c, ok := any(&saved.Item).(utils.Connectable); ok {
+			c.ResetConnections()
+		}
+		e := makeEntry[T](saved.Seq)
+		e.set(saved.Item)
+		m.entries[saved.Item.GetID()] = e
+		restored++
+	}
+	log.Printf("Restored %d %s snapshots", restored, m.kind)
+	return nil
+}
+
+func (m *Manager[T]) markDirty(id string) {
+	m.dirtyMu.Lock()
+	defer m.dirtyMu.Unlock()
+	m.dirty[id] = true
+}
+
+// save everything that changed since the last flush; deleted items have their snapshots removed
+func (m *Manager[T]) Flush() {
+	if m.store == nil {
+		return
+	}
+	m.dirtyMu.Lock()
+	ids := m.dirty
+	m.dirty = make(map[string]bool)
+	m.dirtyMu.Unlock()
+
+	for id := range ids {
+		var data []byte
+		var err error
+		live := false
+		if e, exists := m.getEntry(id); exists {
+			e.mu.Lock()
+			if !e.deleted {
+				live = true
+				data, err = json.Marshal(snapshot[T]{e.seq, e.item})
+			}
+			e.mu.Unlock()
+		}
+		if err == nil {
+			if live {
+				err = m.store.SaveSnapshot(m.kind, id, data)
+			} else {
+				err = m.store.DeleteSnapshot(m.kind, id)
+			}
+		}
+		if err != nil {
+			log.Printf("When saving %s snapshot %s, got error %v", m.kind, id, err)
+			// try again next time
+			m.markDirty(id)
+		}
+	}
+}
+
+// restore live items and start saving them
+func persistManagers(store db.SnapshotStore) error {
+	if err := lobbyManager.Persist("lobby", store); err != nil {
+		return err
+	}
+	if err := bidManager.Persist("bid", store); err != nil {
+		return err
+	}
+	if err := gameManager.Persist("game", store); err != nil {
+		return err
+	}
+	return matchManager.Persist("match", store)
+}
+
+// save any unsaved changes, e.g. before shutting down
+func FlushSnapshots() {
+	lobbyManager.Flush()
+	bidManager.Flush()
+	gameManager.Flush()
+	matchManager.Flush()
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/quevivasbien/bird-game/game"
+)
+
+// an app serving the lobby and match routes, with every request made as authInfo
+func testApp(authInfo JWTPayload) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(AUTH_LOCALS_KEY, authResult{info: authInfo})
+		return c.Next()
+	})
+	setupLobbies(app.Group("/lobbies"))
+	setupMatches(app.Group("/matches"))
+	return app
+}
+
+// status of a request to open a stream on the lobby, over SSE or a websocket
+func openLobbyStream(t *testing.T, app *fiber.App, path string, websocket bool) int {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if websocket {
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestSpectatingDisabledRejectsStreams(t *testing.T) {
+	lobby := game.MakeLobby("spectest", "alice")
+	lobby.Spectating.Allowed = false
+	lobbyManager.Put(lobby)
+	t.Cleanup(func() { lobbyManager.Delete(lobby.ID, EmptyCode) })
+
+	app := testApp(JWTPayload{Name: "eve"})
+	tests := []struct {
+		name      string
+		path      string
+		websocket bool
+	}{
+		{"SSE", "/lobbies/spectest/subscribe", false},
+		{"websocket", "/lobbies/spectest/ws", true},
+	}
+	for _, test := range tests {
+		if status := openLobbyStream(t, app, test.path, test.websocket); status != fiber.StatusUnauthorized && status != fiber.StatusForbidden {
+			t.Errorf("%s: non-member opened a stream with status %d", test.name, status)
+		}
+	}
+	if l, _ := lobbyManager.Get(lobby.ID); len(l.Spectators) != 0 {
+		t.Errorf("turned away non-member was added to spectators: %v", l.Spectators)
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"log"
+	"sync"
+
+	"github.com/quevivasbien/bird-game/game"
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// bots take their turns in the background, outside of any request
+// each move is decided without holding the item's lock, then applied with its own Update,
+// so a slow strategy (a long search, or an external bot) doesn't hold up anyone else at the table
+
+// live items where bots can have a turn
+type botTable interface {
+	utils.Manageable
+	NextBotMove() (game.BotMove, bool)
+}
+
+type botMover[T any] interface {
+	*T
+	ApplyBotMove(d game.BotDecision) error
+}
+
+// keeps at most one bot loop going per item, so that each bot turn is decided only once
+// running maps an item's ID to whether its loop was asked to start again while it was going
+type botLoops struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func makeBotLoops() *botLoops {
+	return &botLoops{running: make(map[string]bool)}
+}
+
+var (
+	bidBots  = makeBotLoops()
+	gameBots = makeBotLoops()
+)
+
+// whether the caller should run the loop for id; if one is already going, it's told to go again instead
+func (l *botLoops) claim(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, exists := l.running[id]; exists {
+		l.running[id] = true
+		return false
+	}
+	l.running[id] = false
+	return true
+}
+
+// whether the loop for id should go again, because it was asked to while it was running
+// if not, the loop is over and the next claim starts a new one
+func (l *botLoops) again(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running[id] {
+		l.running[id] = false
+		return true
+	}
+	delete(l.running, id)
+	return false
+}
+
+// make bots' moves in item id until it's a person's turn or the item is gone,
+// unless bots in the item are already being played by another call
+// after, if set, is called with the item following each move
+func playBotTurns[T botTable, PT botMover[T]](m *Manager[T], loops *botLoops, id string, after func(T) error) {
+	if !loops.claim(id) {
+		return
+	}
+	for {
+		playBotMoves[T, PT](m, id, after)
+		if !loops.again(id) {
+			return
+		}
+	}
+}
+
+// make bots' moves in item id, one at a time, until it's a person's turn or the item is gone
+func playBotMoves[T botTable, PT botMover[T]](m *Manager[T], id string, after func(T) error) {
+	for {
+		item, exists := m.Get(id)
+		if !exists {
+			return
+		}
+		move, ok := item.NextBotMove()
+		if !ok {
+			return
+		}
+		decision := move.Decide()
+		var updated T
+		err := m.Update(id, func(item *T) error {
+			if err := PT(item).ApplyBotMove(decision); err != nil {
+				return err
+			}
+			updated = *item
+			return nil
+		})
+		switch err.(type) {
+		case nil:
+		case game.StaleBotMove, ItemNotFound:
+			// someone else has moved the item along in the meantime
+			return
+		default:
+			log.Printf("When applying bot move in %s, got error %v", id, err)
+			return
+		}
+		if after == nil {
+			continue
+		}
+		if err := after(updated); err != nil {
+			log.Printf("After bot move in %s, got error %v", id, err)
+			return
+		}
+	}
+}
+
+// let bots bid until it's a person's turn, ending the auction if a bot finishes it
+func startBidBots(id string) {
+	go playBotTurns[game.BidState](bidManager, bidBots, id, func(b game.BidState) error {
+		if b.Done {
+			return endBidding(b)
+		}
+		return nil
+	})
+}
+
+// let bots choose trump and play cards until it's a person's turn
+func startGameBots(id string) {
+	go playBotTurns[game.GameState](gameManager, gameBots, id, nil)
+}
+
+// pick up where bots left off in items restored after a restart
+func resumeBots() {
+	for _, id := range bidManager.IDs() {
+		bidState, exists := bidManager.Get(id)
+		if !exists {
+			continue
+		}
+		if !bidState.Done {
+			startBidBots(id)
+			continue
+		}
+		// the server stopped between the last bid and the start of the game
+		if err := endBidding(bidState); err != nil {
+			log.Printf("When ending restored auction %s, got error %v", id, err)
+		}
+	}
+	for _, id := range gameManager.IDs() {
+		startGameBots(id)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quevivasbien/bird-game/game"
+)
+
+// a bot that takes a while to pass, counting how many times it was asked
+type slowPasser struct {
+	game.EasyStrategy
+	asked *atomic.Int32
+}
+
+func (s slowPasser) Bid(view game.BidView) int {
+	s.asked.Add(1)
+	time.Sleep(time.Millisecond * 10)
+	return 0
+}
+
+func TestBotTurnsDecidedOnce(t *testing.T) {
+	asked := &atomic.Int32{}
+	game.SetExternalStrategies(func(name string) (game.Strategy, bool) {
+		return slowPasser{asked: asked}, name == "slow"
+	})
+	t.Cleanup(func() { game.SetExternalStrategies(nil) })
+
+	m := MakeManager[game.BidState]()
+	m.Put(game.InitializeBidState("a", [4]string{}, 0, game.DefaultRules(), [4]string{"slow", "slow", "slow", "slow"}))
+	loops := makeBotLoops()
+	var applied atomic.Int32
+	countMove := func(game.BidState) error {
+		applied.Add(1)
+		return nil
+	}
+	// every request that changes the auction starts the bots, so they're often started while already going
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			playBotTurns[game.BidState](m, loops, "a", countMove)
+		}()
+	}
+	wg.Wait()
+	if b, _ := m.Get("a"); !b.Done {
+		t.Fatal("bots didn't finish the auction")
+	}
+	if asked.Load() != applied.Load() {
+		t.Errorf("bots were asked for %d bids, but only %d were made", asked.Load(), applied.Load())
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/quevivasbien/bird-game/game"
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// websocket endpoints carry the same updates as the /subscribe streams, and also accept actions,
+// so a client can do everything over one connection
+//
+// the server sends
+//   {"type": "update", "id": <event id>, "data": <same payload as the SSE update event>}
+//   {"type": "continue" | "delete", "id": <event id>}, after which the connection is closed
+//   {"type": "ok" | "error", "ref": <ref from the action>, "status": <http status>, "message": "..."}
+// and the client sends actions like
+//   {"type": "bid", "ref": "anything", "amount": 120}
+// see lobbyActions, bidActions and gameActions for what each endpoint accepts
+//
+// to resume, reconnect with ?lastEventId=<last event id seen>, as with the SSE streams
+
+const WS_WRITE_TIMEOUT time.Duration = time.Second * 10
+
+type wsMessage struct {
+	Type    string          `json:"type"`
+	ID      int             `json:"id,omitempty"`
+	Ref     string          `json:"ref,omitempty"`
+	Status  int             `json:"status,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// an action sent by the client; only the fields for its type are used
+type wsAction struct {
+	Type       string    `json:"type"`
+	Ref        string    `json:"ref"`
+	Amount     int       `json:"amount"` // bid
+	Card       game.Card `json:"card"`   // play
+	roundSetup           // start
+}
+
+// carry out an action for the connected user on the item with the given id
+type wsHandler func(authInfo JWTPayload, id string, action wsAction) error
+
+// check that the request is a websocket upgrade from someone allowed to watch the item named by param,
+// by the same rule as the SSE streams; anyone else has to join over REST before connecting
+func upgradeWebSocket[T utils.Manageable](m *Manager[T], param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return c.SendStatus(fiber.StatusUpgradeRequired)
+		}
+		authInfo, err := getAuthInfo(c)
+		if err != nil {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		item, exists := m.GetRecent(c.Params(param))
+		if !exists {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if !canWatch(item, authInfo) {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		c.Locals("authInfo", authInfo)
+		return c.Next()
+	}
+}
+
+// stream updates to the item over conn while handling actions the client sends
+func serveWebSocket[T utils.Manageable](m *Manager[T], conn *websocket.Conn, id string, actions map[string]wsHandler) {
+	authInfo, _ := conn.Locals("authInfo").(JWTPayload)
+	player := authInfo.Name
+	lastID, err := strconv.Atoi(conn.Query("lastEventId"))
+	if err != nil {
+		lastID = -1
+	}
+	s, err := m.open(id, player, lastID)
+	if err != nil {
+		log.Println("When opening websocket stream:", err)
+		return
+	}
+	defer s.close()
+
+	var mu sync.Mutex
+	send := func(msg wsMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT))
+		return conn.WriteJSON(msg)
+	}
+	sendEvent := func(ev event[T]) error {
+		if data, ok := s.render(ev); ok {
+			return send(wsMessage{Type: "update", ID: ev.id, Data: data})
+		}
+		return nil
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		// closing the connection also ends the read loop below
+		defer conn.Close()
+		for _, ev := range s.start() {
+			if err := sendEvent(ev); err != nil {
+				return
+			}
+		}
+		heartbeat := time.NewTicker(HEARTBEAT_INTVL)
+		defer heartbeat.Stop()
+		for {
+			var err error
+			select {
+			case <-done:
+				return
+			case <-heartbeat.C:
+				mu.Lock()
+				err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WS_WRITE_TIMEOUT))
+				mu.Unlock()
+			case <-s.timer.C:
+				for _, ev := range s.wake() {
+					if err = sendEvent(ev); err != nil {
+						break
+					}
+				}
+			case ev := <-s.sub.data:
+				for _, ev := range s.push(ev) {
+					if err = sendEvent(ev); err != nil {
+						break
+					}
+				}
+			case ev := <-s.sub.close:
+				if ev.code == ContinueCode {
+					send(wsMessage{Type: "continue", ID: ev.id})
+				} else if ev.code != ReplacedCode {
+					send(wsMessage{Type: "delete", ID: ev.id})
+				}
+				return
+			}
+			if err != nil {
+				log.Printf("Error while writing to websocket: %v. Closing connection.", err)
+				return
+			}
+		}
+	}()
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		action := wsAction{}
+		if err := json.Unmarshal(raw, &action); err != nil {
+			send(wsMessage{Type: "error", Status: fiber.StatusBadRequest, Message: "Could not parse action: " + err.Error()})
+			continue
+		}
+		handle, exists := actions[action.Type]
+		if !exists {
+			send(wsMessage{Type: "error", Ref: action.Ref, Status: fiber.StatusBadRequest, Message: "Unknown action " + action.Type})
+			continue
+		}
+		if err := handle(authInfo, id, action); err != nil {
+			status, msg := errorStatus(err)
+			send(wsMessage{Type: "error", Ref: action.Ref, Status: status, Message: msg})
+			continue
+		}
+		send(wsMessage{Type: "ok", Ref: action.Ref, Status: fiber.StatusOK})
+	}
+	close(done)
+	<-finished
+}
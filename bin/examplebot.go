@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/quevivasbien/bird-game/game"
+)
+
+// a bot that speaks the external bot protocol described in api/bots.go, making its moves with a built-in strategy
+// register it with POST /api/admin/bots {"name": "example", "url": "http://localhost:9100"},
+// then pass the secret from the response in BIRD_BOT_SECRET so it can check requests are signed
+
+const EXAMPLE_BOT_DEFAULT_PORT = "9100"
+const EXAMPLE_BOT_STRATEGY = "medium"
+const EXAMPLE_BOT_SECRET_ENV = "BIRD_BOT_SECRET"
+
+type exampleBot struct {
+	secret   string
+	strategy game.Strategy
+}
+
+func (b exampleBot) checkSignature(r *http.Request, body []byte) bool {
+	if b.secret == "" {
+		return true
+	}
+	signature, ok := strings.CutPrefix(r.Header.Get("X-Bird-Signature"), "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(b.secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func (b exampleBot) decide(kind string, view json.RawMessage) (interface{}, error) {
+	switch kind {
+	case "bid":
+		v := game.BidView{}
+		if err := json.Unmarshal(view, &v); err != nil {
+			return nil, err
+		}
+		return map[string]int{"bid": b.strategy.Bid(v)}, nil
+	case "widow":
+		v := game.WidowView{}
+		if err := json.Unmarshal(view, &v); err != nil {
+			return nil, err
+		}
+		trump := b.strategy.ChooseTrump(v)
+		toWidow, fromWidow := b.strategy.ExchangeWidow(v, trump)
+		return map[string]interface{}{"trump": trump, "toWidow": toWidow, "fromWidow": fromWidow}, nil
+	case "play":
+		v := game.PlayView{}
+		if err := json.Unmarshal(view, &v); err != nil {
+			return nil, err
+		}
+		return map[string]game.Card{"card": b.strategy.PlayCard(v)}, nil
+	default:
+		return nil, fmt.Errorf("Unknown request type %q", kind)
+	}
+}
+
+func (b exampleBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !b.checkSignature(r, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	request := struct {
+		Type string          `json:"type"`
+		View json.RawMessage `json:"view"`
+	}{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	reply, err := b.decide(request.Type, request.View)
+	if err != nil {
+		log.Println("When deciding:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	log.Printf("%s request: answering %v", request.Type, reply)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reply)
+}
+
+func ExampleBot(port string) {
+	bot := exampleBot{
+		secret:   os.Getenv(EXAMPLE_BOT_SECRET_ENV),
+		strategy: game.GetStrategy(EXAMPLE_BOT_STRATEGY),
+	}
+	if bot.secret == "" {
+		fmt.Printf("%s is not set; requests won't be checked for a signature\n", EXAMPLE_BOT_SECRET_ENV)
+	}
+	fmt.Println("Example bot listening at http://localhost:" + port)
+	log.Fatal(http.ListenAndServe(":"+port, bot))
+}
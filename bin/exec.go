@@ -8,7 +8,14 @@ import (
 	"github.com/quevivasbien/bird-game/db"
 )
 
-const AWS_REGION = "us-east-1"
+// uses the same BIRD_STORAGE etc. environment variables as the server
+func openStorage() db.Storage {
+	storage, err := db.OpenStorage(db.StorageConfigFromEnv())
+	if err != nil {
+		panic(fmt.Sprint("Problem opening storage:", err))
+	}
+	return storage
+}
 
 func Help() {
 	space := strings.Repeat(" ", 3)
@@ -17,56 +24,83 @@ func Help() {
 	fmt.Println("- listusers" + space + "(list all users currently in database)")
 	fmt.Println("- deluser [name]" + space + "(delete user)")
 	fmt.Println("- makeadmin [name] [password]" + space + "(create admin account)")
+	fmt.Println("- migratepasswords" + space + "(hash any passwords still stored in plaintext)")
+	fmt.Println("- mockoidc [port]" + space + "(run a mock OIDC provider for testing logins, on port " + MOCK_OIDC_DEFAULT_PORT + " by default)")
+	fmt.Println("- examplebot [port]" + space + "(run a bot that can be registered for empty seats, on port " + EXAMPLE_BOT_DEFAULT_PORT + " by default)")
+	fmt.Println("Set BIRD_STORAGE=bolt (and optionally BIRD_DB_PATH) to use a local database file instead of dynamodb")
 }
 
 func ResetDB() {
-	tables, err := db.GetTables(AWS_REGION)
+	storage := openStorage()
+	defer storage.Close()
+	err := storage.Reset()
 	if err != nil {
-		panic(fmt.Sprint("Problem getting existing tables:", err))
-	}
-	err = tables.Reset()
-	if err != nil {
-		panic(fmt.Sprint("Problem while resetting tables:", err))
+		panic(fmt.Sprint("Problem while resetting database:", err))
 	}
 	fmt.Println("Successfully reset database")
 }
 
 func ListUsers() {
-	tables, err := db.GetTables(AWS_REGION)
-	if err != nil {
-		panic(fmt.Sprint("Problem getting existing tables:", err))
-	}
-	users, err := tables.AllUsers()
+	storage := openStorage()
+	defer storage.Close()
+	users, err := storage.AllUsers()
 	if err != nil {
-		panic(fmt.Sprint("Problem getting existing tables:", err))
+		panic(fmt.Sprint("Problem getting users:", err))
 	}
 	fmt.Printf("Users (%d):\n", len(users))
 	for i, user := range users {
-		fmt.Printf("%d: %v\n", i+1, user)
+		fmt.Printf("%d: %s", i+1, user.Name)
+		if user.Admin {
+			fmt.Print(" (admin)")
+		}
+		fmt.Println()
 	}
 }
 
 func MakeAdmin(name string, password string) {
-	tables, err := db.GetTables(AWS_REGION)
+	storage := openStorage()
+	defer storage.Close()
+	user, err := db.NewUser(name, password, true)
 	if err != nil {
-		panic(fmt.Sprint("Problem getting existing tables:", err))
+		panic(fmt.Sprint("Problem creating admin user:", err))
 	}
-	err = tables.PutUser(db.User{Name: name, Password: password, Admin: true})
+	err = storage.PutUser(user)
 	if err != nil {
 		panic(fmt.Sprint("Problem creating admin user on database:", err))
 	}
 	fmt.Println("Successfully created admin user")
 }
 
-func DelUser(name string) {
-	tables, err := db.GetTables(AWS_REGION)
+func MigratePasswords() {
+	storage := openStorage()
+	defer storage.Close()
+	migrated, skipped, err := db.MigratePasswords(storage)
 	if err != nil {
-		panic(fmt.Sprint("Problem getting existing tables:", err))
+		panic(fmt.Sprint("Problem migrating passwords:", err))
 	}
-	err = tables.DeleteUser(name)
+	fmt.Printf("Successfully hashed passwords for %d users\n", migrated)
+	if len(skipped) > 0 {
+		fmt.Printf("Passwords for %d users are longer than %d bytes and were left as they are; an admin needs to reset them: %s\n",
+			len(skipped), db.MAX_PASSWORD_LENGTH, strings.Join(skipped, ", "))
+	}
+}
+
+func DelUser(name string) {
+	storage := openStorage()
+	defer storage.Close()
+	err := storage.DeleteUser(name)
 	if err != nil {
 		panic(fmt.Sprint("Problem deleting user:", err))
 	}
+	// make sure they can't keep playing on an existing login
+	_, err = db.RevokeUserSessions(storage, name)
+	if err != nil {
+		panic(fmt.Sprint("Problem revoking user's sessions:", err))
+	}
+	_, err = db.RevokeUserAPITokens(storage, name)
+	if err != nil {
+		panic(fmt.Sprint("Problem revoking user's api tokens:", err))
+	}
 	fmt.Println("Successfully deleted user")
 }
 
@@ -81,6 +115,20 @@ func main() {
 		ResetDB()
 	} else if command == "listusers" {
 		ListUsers()
+	} else if command == "migratepasswords" {
+		MigratePasswords()
+	} else if command == "mockoidc" {
+		if len(os.Args) < 3 {
+			MockOIDC(MOCK_OIDC_DEFAULT_PORT)
+		} else {
+			MockOIDC(os.Args[2])
+		}
+	} else if command == "examplebot" {
+		if len(os.Args) < 3 {
+			ExampleBot(EXAMPLE_BOT_DEFAULT_PORT)
+		} else {
+			ExampleBot(os.Args[2])
+		}
 	} else if command == "deluser" {
 		if len(os.Args) < 3 {
 			fmt.Println("Missing username to delete")
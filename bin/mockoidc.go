@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/quevivasbien/bird-game/db"
+)
+
+// a minimal OpenID Connect provider for trying out OIDC logins locally
+// anyone can sign in as any username; the username is also used as the subject
+// supports only the authorization code flow with S256 PKCE
+
+const MOCK_OIDC_DEFAULT_PORT = "9000"
+const MOCK_OIDC_CLIENT_ID = "bird"
+const MOCK_OIDC_CLIENT_SECRET = "bird-secret"
+const MOCK_OIDC_KID = "mock"
+const MOCK_OIDC_CODE_LIFETIME time.Duration = time.Minute
+const MOCK_OIDC_TOKEN_LIFETIME time.Duration = time.Hour
+
+type mockAuthCode struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	username    string
+	expires     time.Time
+}
+
+type mockOIDC struct {
+	issuer string
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	codes  map[string]mockAuthCode
+}
+
+var mockLoginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><body>
+<h1>Mock OIDC provider</h1>
+<form method="get" action="/authorize">
+{{range $key, $values := .}}{{range $values}}<input type="hidden" name="{{$key}}" value="{{.}}">
+{{end}}{{end}}<label>Sign in as <input name="username" autofocus></label>
+<button type="submit">Sign in</button>
+</form>
+</body></html>`))
+
+func mockError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+func mockJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(value)
+}
+
+func (m *mockOIDC) discovery(w http.ResponseWriter, r *http.Request) {
+	mockJSON(w, map[string]interface{}{
+		"issuer":                                m.issuer,
+		"authorization_endpoint":                m.issuer + "/authorize",
+		"token_endpoint":                        m.issuer + "/token",
+		"jwks_uri":                              m.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+	})
+}
+
+func (m *mockOIDC) jwks(w http.ResponseWriter, r *http.Request) {
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	mockJSON(w, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": MOCK_OIDC_KID,
+			"n":   encode(m.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// shows a form asking for a username, then redirects back to the client with a code
+func (m *mockOIDC) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != MOCK_OIDC_CLIENT_ID || redirectURI == "" {
+		http.Error(w, "Unknown client_id or missing redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "Only the code flow with S256 PKCE is supported", http.StatusBadRequest)
+		return
+	}
+	username := query.Get("username")
+	if username == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		mockLoginPage.Execute(w, query)
+		return
+	}
+	code, err := db.RandomToken(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	m.mu.Lock()
+	m.codes[code] = mockAuthCode{
+		redirectURI: redirectURI,
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		username:    username,
+		expires:     time.Now().Add(MOCK_OIDC_CODE_LIFETIME),
+	}
+	m.mu.Unlock()
+	back, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	params := back.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	back.RawQuery = params.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+func (m *mockOIDC) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		mockError(w, http.StatusMethodNotAllowed, "invalid_request", "Use POST")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != MOCK_OIDC_CLIENT_ID || clientSecret != MOCK_OIDC_CLIENT_SECRET {
+		mockError(w, http.StatusUnauthorized, "invalid_client", "Unknown client or wrong secret")
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		mockError(w, http.StatusBadRequest, "unsupported_grant_type", "Only authorization_code is supported")
+		return
+	}
+	m.mu.Lock()
+	code, found := m.codes[r.PostFormValue("code")]
+	// codes can only be used once
+	delete(m.codes, r.PostFormValue("code"))
+	m.mu.Unlock()
+	if !found || time.Now().After(code.expires) || code.redirectURI != r.PostFormValue("redirect_uri") {
+		mockError(w, http.StatusBadRequest, "invalid_grant", "Unknown or expired code")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		mockError(w, http.StatusBadRequest, "invalid_grant", "Code verifier doesn't match challenge")
+		return
+	}
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                m.issuer,
+		"sub":                code.username,
+		"aud":                MOCK_OIDC_CLIENT_ID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(MOCK_OIDC_TOKEN_LIFETIME).Unix(),
+		"nonce":              code.nonce,
+		"preferred_username": code.username,
+		"name":               code.username,
+		"email":              code.username + "@example.com",
+	})
+	idToken.Header["kid"] = MOCK_OIDC_KID
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		mockError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	accessToken, err := db.RandomToken(16)
+	if err != nil {
+		mockError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	mockJSON(w, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(MOCK_OIDC_TOKEN_LIFETIME.Seconds()),
+		"id_token":     signed,
+	})
+}
+
+func MockOIDC(port string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprint("Problem generating signing key:", err))
+	}
+	m := &mockOIDC{
+		issuer: "http://localhost:" + port,
+		key:    key,
+		codes:  make(map[string]mockAuthCode),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+	fmt.Println("Mock OIDC provider running at", m.issuer)
+	fmt.Println("Start the server with:")
+	fmt.Printf("  BIRD_OIDC_ISSUER=%s BIRD_OIDC_CLIENT_ID=%s BIRD_OIDC_CLIENT_SECRET=%s BIRD_OIDC_REDIRECT_URL=http://localhost:3000/api/auth/oidc/callback\n",
+		m.issuer, MOCK_OIDC_CLIENT_ID, MOCK_OIDC_CLIENT_SECRET)
+	log.Fatal(http.ListenAndServe(":"+port, mux))
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// a long-lived credential for bots and scripts, sent as "Authorization: Bearer <token>"
+// tokens look like bird_<id>.<secret>; only a hash of the secret is stored
+type APIToken struct {
+	ID         string   `json:"id"`
+	User       string   `json:"user"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	SecretHash string   `json:"secretHash"`
+	Created    int64    `json:"created"`
+	Expires    int64    `json:"expires"` // 0 for tokens that don't expire
+}
+
+// marks a bearer token as an api token rather than a jwt
+const API_TOKEN_PREFIX = "bird_"
+
+type APITokenStore interface {
+	GetAPIToken(id string) (APIToken, error)
+	PutAPIToken(t APIToken) error
+	DeleteAPIToken(id string) error
+	// all unexpired tokens belonging to user
+	UserAPITokens(user string) ([]APIToken, error)
+}
+
+// make a token for user; returns the token and the string to hand to the user, which can't be recovered later
+// if lifetime is 0, the token doesn't expire
+func NewAPIToken(user string, name string, scopes []string, lifetime time.Duration) (APIToken, string, error) {
+	id, err := RandomToken(9)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	secret, err := RandomToken(32)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	now := time.Now()
+	t := APIToken{
+		ID:         id,
+		User:       user,
+		Name:       name,
+		Scopes:     scopes,
+		SecretHash: hashSecret(secret),
+		Created:    now.Unix(),
+	}
+	if lifetime > 0 {
+		t.Expires = now.Add(lifetime).Unix()
+	}
+	return t, API_TOKEN_PREFIX + id + "." + secret, nil
+}
+
+// split a token into its id and secret; ok is false if it isn't an api token
+func ParseAPIToken(token string) (id string, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(token, API_TOKEN_PREFIX)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ".")
+}
+
+func (t APIToken) CheckSecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(t.SecretHash), []byte(hashSecret(secret))) == 1
+}
+
+func (t APIToken) Expired() bool {
+	return t.Expires != 0 && time.Now().Unix() >= t.Expires
+}
+
+// delete all of the user's tokens; returns the number revoked
+func RevokeUserAPITokens(store APITokenStore, user string) (int, error) {
+	tokens, err := store.UserAPITokens(user)
+	if err != nil {
+		return 0, err
+	}
+	for i, t := range tokens {
+		if err := store.DeleteAPIToken(t.ID); err != nil {
+			return i, fmt.Errorf("Error when revoking api token for %s: %v", user, err)
+		}
+	}
+	return len(tokens), nil
+}
+
+const API_TOKEN_TABLE_NAME = "Bird.APITokens"
+
+type APITokenTable struct {
+	client *dynamodb.Client
+}
+
+func (t APITokenTable) Client() *dynamodb.Client {
+	return t.client
+}
+
+func (t APITokenTable) Name() string {
+	return API_TOKEN_TABLE_NAME
+}
+
+func (t APITokenTable) IndexName() string {
+	return "ID"
+}
+
+func (t APITokenTable) IndexType() types.ScalarAttributeType {
+	return types.ScalarAttributeTypeS
+}
+
+func MakeAPITokenTable(client *dynamodb.Client) (APITokenTable, error) {
+	table := APITokenTable{client}
+	exists, err := tableIsInitialized(table)
+	if err != nil {
+		return table, fmt.Errorf("Error when checking if api token table exists: %v", err)
+	}
+	if exists {
+		return table, nil
+	} else {
+		err = initTable(table)
+		return table, err
+	}
+}
+
+func (t APITokenTable) GetAPIToken(id string) (APIToken, error) {
+	itemMap, err := getItem(t, id)
+	if err != nil {
+		return APIToken{}, err
+	}
+	if itemMap == nil {
+		return APIToken{}, ItemNotFound{"API token"}
+	}
+	token := APIToken{}
+	err = attributevalue.UnmarshalMap(itemMap, &token)
+	if err != nil {
+		return token, fmt.Errorf("Error when unpacking api token: %v", err)
+	}
+	return token, nil
+}
+
+func (t APITokenTable) PutAPIToken(token APIToken) error {
+	return putItem(t, token)
+}
+
+func (t APITokenTable) DeleteAPIToken(id string) error {
+	return deleteItem(t, id)
+}
+
+func (t APITokenTable) UserAPITokens(user string) ([]APIToken, error) {
+	tokens := []APIToken{}
+	paginator := dynamodb.NewScanPaginator(t.client, &dynamodb.ScanInput{
+		TableName:                aws.String(t.Name()),
+		FilterExpression:         aws.String("#user = :user"),
+		ExpressionAttributeNames: map[string]string{"#user": "User"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user": &types.AttributeValueMemberS{Value: user},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("Error when scanning api tokens for %s: %v", user, err)
+		}
+		for _, item := range page.Items {
+			token := APIToken{}
+			if err := attributevalue.UnmarshalMap(item, &token); err != nil {
+				return nil, fmt.Errorf("Error when unpacking api token: %v", err)
+			}
+			if !token.Expired() {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,516 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// storage in a single local file, for running without AWS, e.g. on a laptop or in CI
+
+const BOLT_OPEN_TIMEOUT time.Duration = time.Second * 5
+
+var (
+	BOLT_USER_BUCKET     = []byte("Users")
+	BOLT_SNAPSHOT_BUCKET = []byte("Snapshots")
+	BOLT_SESSION_BUCKET  = []byte("Sessions")
+	BOLT_DENYLIST_BUCKET = []byte("Denylist")
+	BOLT_ATTEMPTS_BUCKET = []byte("LoginAttempts")
+	BOLT_AUDIT_BUCKET    = []byte("LoginAudit")
+	BOLT_IDENTITY_BUCKET = []byte("Identities")
+	BOLT_TOKEN_BUCKET    = []byte("APITokens")
+	BOLT_BOT_BUCKET      = []byte("Bots")
+)
+
+var boltBuckets = [][]byte{
+	BOLT_USER_BUCKET,
+	BOLT_SNAPSHOT_BUCKET,
+	BOLT_SESSION_BUCKET,
+	BOLT_DENYLIST_BUCKET,
+	BOLT_ATTEMPTS_BUCKET,
+	BOLT_AUDIT_BUCKET,
+	BOLT_IDENTITY_BUCKET,
+	BOLT_TOKEN_BUCKET,
+	BOLT_BOT_BUCKET,
+}
+
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// open the database file at path, creating it if it doesn't exist yet
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: BOLT_OPEN_TIMEOUT})
+	if err == bolt.ErrTimeout {
+		// only one process can have the file open at a time
+		return nil, fmt.Errorf("Timed out waiting for database file %s; is the server still running?", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error when opening database file %s: %v", path, err)
+	}
+	s := &BoltStore{db}
+	if err := s.initBuckets(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *BoltStore) initBuckets() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("Error when creating bucket %s: %v", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Reset() error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+				return fmt.Errorf("Error when deleting bucket %s: %v", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.initBuckets()
+}
+
+func (s *BoltStore) get(bucket []byte, key string, item interface{}) (bool, error) {
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, item)
+	})
+	if err != nil {
+		return found, fmt.Errorf("Error when fetching item %s from bucket %s: %v", key, bucket, err)
+	}
+	return found, nil
+}
+
+func (s *BoltStore) put(bucket []byte, key string, item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("Error when packing item to be placed in bucket %s: %v", bucket, err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("Error adding item to bucket %s: %v", bucket, err)
+	}
+	return nil
+}
+
+func (s *BoltStore) delete(bucket []byte, key string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("Error when deleting item %s from bucket %s: %v", key, bucket, err)
+	}
+	return nil
+}
+
+func (s *BoltStore) GetUser(name string) (User, error) {
+	user := User{}
+	found, err := s.get(BOLT_USER_BUCKET, name, &user)
+	if err != nil {
+		return User{}, err
+	}
+	if !found {
+		return User{}, ItemNotFound{"User"}
+	}
+	return user, nil
+}
+
+func (s *BoltStore) PutUser(u User) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("Error when packing user: %v", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BOLT_USER_BUCKET)
+		if bucket.Get([]byte(u.Name)) != nil {
+			return ItemAlreadyExists{"User"}
+		}
+		return bucket.Put([]byte(u.Name), data)
+	})
+}
+
+// updates are keyed by field name, as with the dynamodb attributes
+func (s *BoltStore) UpdateUser(name string, updates map[string]interface{}) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BOLT_USER_BUCKET)
+		data := bucket.Get([]byte(name))
+		if data == nil {
+			return ItemNotFound{"User"}
+		}
+		user := User{}
+		if err := json.Unmarshal(data, &user); err != nil {
+			return fmt.Errorf("Error when unpacking user: %v", err)
+		}
+		if err := setFields(&user, updates); err != nil {
+			return err
+		}
+		data, err := json.Marshal(user)
+		if err != nil {
+			return fmt.Errorf("Error when packing user: %v", err)
+		}
+		return bucket.Put([]byte(name), data)
+	})
+}
+
+func (s *BoltStore) DeleteUser(name string) error {
+	return s.delete(BOLT_USER_BUCKET, name)
+}
+
+func (s *BoltStore) RenameUser(oldName string, newName string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BOLT_USER_BUCKET)
+		data := bucket.Get([]byte(oldName))
+		if data == nil {
+			return ItemNotFound{"User"}
+		}
+		if bucket.Get([]byte(newName)) != nil {
+			return ItemAlreadyExists{"User"}
+		}
+		user := User{}
+		if err := json.Unmarshal(data, &user); err != nil {
+			return fmt.Errorf("Error when unpacking user: %v", err)
+		}
+		user.Name = newName
+		data, err := json.Marshal(user)
+		if err != nil {
+			return fmt.Errorf("Error when packing user: %v", err)
+		}
+		if err := bucket.Put([]byte(newName), data); err != nil {
+			return err
+		}
+		if err := bucket.Delete([]byte(oldName)); err != nil {
+			return err
+		}
+		if user.Identity == "" {
+			return nil
+		}
+		data, err = json.Marshal(Identity{ID: user.Identity, User: newName})
+		if err != nil {
+			return fmt.Errorf("Error when packing identity: %v", err)
+		}
+		return tx.Bucket(BOLT_IDENTITY_BUCKET).Put([]byte(user.Identity), data)
+	})
+}
+
+func (s *BoltStore) UserExists(name string) (bool, error) {
+	return userExists(s, name)
+}
+
+func (s *BoltStore) ValidateUser(name string, password string) (bool, User, error) {
+	return validateUser(s, name, password)
+}
+
+func (s *BoltStore) AllUsers() ([]User, error) {
+	users := []User{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(BOLT_USER_BUCKET).ForEach(func(_, data []byte) error {
+			user := User{}
+			if err := json.Unmarshal(data, &user); err != nil {
+				return fmt.Errorf("Error when unpacking user: %v", err)
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	return users, err
+}
+
+func (s *BoltStore) SaveSnapshot(kind string, id string, data []byte) error {
+	return s.put(BOLT_SNAPSHOT_BUCKET, snapshotKey(kind, id), Snapshot{
+		Key:     snapshotKey(kind, id),
+		Kind:    kind,
+		ID:      id,
+		Data:    string(data),
+		Updated: time.Now().Unix(),
+	})
+}
+
+func (s *BoltStore) DeleteSnapshot(kind string, id string) error {
+	return s.delete(BOLT_SNAPSHOT_BUCKET, snapshotKey(kind, id))
+}
+
+func (s *BoltStore) LoadSnapshots(kind string) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	prefix := []byte(snapshotKey(kind, ""))
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(BOLT_SNAPSHOT_BUCKET).Cursor()
+		for k, data := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, data = c.Next() {
+			snapshot := Snapshot{}
+			if err := json.Unmarshal(data, &snapshot); err != nil {
+				return fmt.Errorf("Error when unpacking snapshot: %v", err)
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+		return nil
+	})
+	return snapshots, err
+}
+
+func (s *BoltStore) GetSession(id string) (Session, error) {
+	session := Session{}
+	found, err := s.get(BOLT_SESSION_BUCKET, id, &session)
+	if err != nil {
+		return Session{}, err
+	}
+	if !found {
+		return Session{}, ItemNotFound{"Session"}
+	}
+	return session, nil
+}
+
+func (s *BoltStore) PutSession(session Session) error {
+	return s.put(BOLT_SESSION_BUCKET, session.ID, session)
+}
+
+func (s *BoltStore) DeleteSession(id string) error {
+	return s.delete(BOLT_SESSION_BUCKET, id)
+}
+
+func (s *BoltStore) UserSessions(user string) ([]Session, error) {
+	sessions := []Session{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(BOLT_SESSION_BUCKET).ForEach(func(_, data []byte) error {
+			session := Session{}
+			if err := json.Unmarshal(data, &session); err != nil {
+				return fmt.Errorf("Error when unpacking session: %v", err)
+			}
+			if session.User == user && !session.Expired() {
+				sessions = append(sessions, session)
+			}
+			return nil
+		})
+	})
+	return sessions, err
+}
+
+func (s *BoltStore) DenyToken(token DeniedToken) error {
+	return s.put(BOLT_DENYLIST_BUCKET, token.JTI, token)
+}
+
+// expired tokens are removed as they're found
+func (s *BoltStore) DeniedTokens() ([]DeniedToken, error) {
+	tokens := []DeniedToken{}
+	now := time.Now().Unix()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BOLT_DENYLIST_BUCKET)
+		expired := [][]byte{}
+		err := bucket.ForEach(func(k, data []byte) error {
+			token := DeniedToken{}
+			if err := json.Unmarshal(data, &token); err != nil {
+				return fmt.Errorf("Error when unpacking denied token: %v", err)
+			}
+			if token.Expires > now {
+				tokens = append(tokens, token)
+			} else {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return tokens, err
+}
+
+func (s *BoltStore) GetLoginAttempts(key string) (LoginAttempts, error) {
+	attempts := LoginAttempts{Key: key}
+	_, err := s.get(BOLT_ATTEMPTS_BUCKET, key, &attempts)
+	return attempts, err
+}
+
+func (s *BoltStore) PutLoginAttempts(a LoginAttempts) error {
+	return s.put(BOLT_ATTEMPTS_BUCKET, a.Key, a)
+}
+
+func (s *BoltStore) DeleteLoginAttempts(key string) error {
+	return s.delete(BOLT_ATTEMPTS_BUCKET, key)
+}
+
+func (s *BoltStore) AddLoginAudit(e LoginAuditEntry) error {
+	return s.put(BOLT_AUDIT_BUCKET, e.ID, e)
+}
+
+// ids sort by time, so this only reads entries from since onwards
+func (s *BoltStore) LoginAudit(since int64) ([]LoginAuditEntry, error) {
+	entries := []LoginAuditEntry{}
+	start := []byte(fmt.Sprintf("%020d", time.Unix(since, 0).UnixNano()))
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(BOLT_AUDIT_BUCKET).Cursor()
+		for k, data := c.Seek(start); k != nil; k, data = c.Next() {
+			entry := LoginAuditEntry{}
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return fmt.Errorf("Error when unpacking login audit entry: %v", err)
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (s *BoltStore) GetIdentity(id string) (Identity, error) {
+	identity := Identity{}
+	found, err := s.get(BOLT_IDENTITY_BUCKET, id, &identity)
+	if err != nil {
+		return Identity{}, err
+	}
+	if !found {
+		return Identity{}, ItemNotFound{"Identity"}
+	}
+	return identity, nil
+}
+
+func (s *BoltStore) PutIdentity(i Identity) error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("Error when packing identity: %v", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BOLT_IDENTITY_BUCKET)
+		if bucket.Get([]byte(i.ID)) != nil {
+			return ItemAlreadyExists{"Identity"}
+		}
+		return bucket.Put([]byte(i.ID), data)
+	})
+}
+
+func (s *BoltStore) DeleteIdentity(id string) error {
+	return s.delete(BOLT_IDENTITY_BUCKET, id)
+}
+
+func (s *BoltStore) GetAPIToken(id string) (APIToken, error) {
+	token := APIToken{}
+	found, err := s.get(BOLT_TOKEN_BUCKET, id, &token)
+	if err != nil {
+		return APIToken{}, err
+	}
+	if !found {
+		return APIToken{}, ItemNotFound{"API token"}
+	}
+	return token, nil
+}
+
+func (s *BoltStore) PutAPIToken(token APIToken) error {
+	return s.put(BOLT_TOKEN_BUCKET, token.ID, token)
+}
+
+func (s *BoltStore) DeleteAPIToken(id string) error {
+	return s.delete(BOLT_TOKEN_BUCKET, id)
+}
+
+func (s *BoltStore) UserAPITokens(user string) ([]APIToken, error) {
+	tokens := []APIToken{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(BOLT_TOKEN_BUCKET).ForEach(func(_, data []byte) error {
+			token := APIToken{}
+			if err := json.Unmarshal(data, &token); err != nil {
+				return fmt.Errorf("Error when unpacking api token: %v", err)
+			}
+			if token.User == user && !token.Expired() {
+				tokens = append(tokens, token)
+			}
+			return nil
+		})
+	})
+	return tokens, err
+}
+
+func (s *BoltStore) GetBot(name string) (Bot, error) {
+	bot := Bot{}
+	found, err := s.get(BOLT_BOT_BUCKET, name, &bot)
+	if err != nil {
+		return Bot{}, err
+	}
+	if !found {
+		return Bot{}, ItemNotFound{"Bot"}
+	}
+	return bot, nil
+}
+
+func (s *BoltStore) PutBot(b Bot) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("Error when packing bot: %v", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BOLT_BOT_BUCKET)
+		if bucket.Get([]byte(b.Name)) != nil {
+			return ItemAlreadyExists{"Bot"}
+		}
+		return bucket.Put([]byte(b.Name), data)
+	})
+}
+
+func (s *BoltStore) UpdateBot(b Bot) error {
+	return s.put(BOLT_BOT_BUCKET, b.Name, b)
+}
+
+func (s *BoltStore) DeleteBot(name string) error {
+	return s.delete(BOLT_BOT_BUCKET, name)
+}
+
+func (s *BoltStore) AllBots() ([]Bot, error) {
+	bots := []Bot{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(BOLT_BOT_BUCKET).ForEach(func(_, data []byte) error {
+			bot := Bot{}
+			if err := json.Unmarshal(data, &bot); err != nil {
+				return fmt.Errorf("Error when unpacking bot: %v", err)
+			}
+			bots = append(bots, bot)
+			return nil
+		})
+	})
+	return bots, err
+}
+
+// set the named fields of the struct that item points to
+func setFields(item interface{}, updates map[string]interface{}) error {
+	v := reflect.ValueOf(item).Elem()
+	for key, value := range updates {
+		field := v.FieldByName(key)
+		if !field.IsValid() || !field.CanSet() {
+			return fmt.Errorf("No field %s to update", key)
+		}
+		newValue := reflect.ValueOf(value)
+		if !newValue.IsValid() || !newValue.Type().AssignableTo(field.Type()) {
+			return fmt.Errorf("Cannot set field %s to %v", key, value)
+		}
+		field.Set(newValue)
+	}
+	return nil
+}
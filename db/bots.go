@@ -0,0 +1,128 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// an external engine that can take an empty seat; the server posts each of the seat's decisions to URL
+// requests are signed with Secret, so it's kept as is rather than hashed
+type Bot struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Secret      string `json:"secret"`
+	Description string `json:"description"`
+	// built-in strategy that decides when the bot doesn't answer in time or answers with something invalid
+	Fallback string `json:"fallback"`
+	Created  int64  `json:"created"`
+}
+
+type BotStore interface {
+	GetBot(name string) (Bot, error)
+	// register a new bot; fails with ItemAlreadyExists if the name is taken
+	PutBot(b Bot) error
+	// replace a bot that's already registered
+	UpdateBot(b Bot) error
+	DeleteBot(name string) error
+	AllBots() ([]Bot, error)
+}
+
+func NewBot(name string, url string, description string, fallback string) (Bot, error) {
+	secret, err := RandomToken(32)
+	if err != nil {
+		return Bot{}, err
+	}
+	return Bot{
+		Name:        name,
+		URL:         url,
+		Secret:      secret,
+		Description: description,
+		Fallback:    fallback,
+		Created:     time.Now().Unix(),
+	}, nil
+}
+
+const BOT_TABLE_NAME = "Bird.Bots"
+
+type BotTable struct {
+	client *dynamodb.Client
+}
+
+func (t BotTable) Client() *dynamodb.Client {
+	return t.client
+}
+
+func (t BotTable) Name() string {
+	return BOT_TABLE_NAME
+}
+
+func (t BotTable) IndexName() string {
+	return "Name"
+}
+
+func (t BotTable) IndexType() types.ScalarAttributeType {
+	return types.ScalarAttributeTypeS
+}
+
+func MakeBotTable(client *dynamodb.Client) (BotTable, error) {
+	table := BotTable{client}
+	exists, err := tableIsInitialized(table)
+	if err != nil {
+		return table, fmt.Errorf("Error when checking if bot table exists: %v", err)
+	}
+	if exists {
+		return table, nil
+	} else {
+		err = initTable(table)
+		return table, err
+	}
+}
+
+func (t BotTable) GetBot(name string) (Bot, error) {
+	itemMap, err := getItem(t, name)
+	if err != nil {
+		return Bot{}, err
+	}
+	if itemMap == nil {
+		return Bot{}, ItemNotFound{"Bot"}
+	}
+	bot := Bot{}
+	err = attributevalue.UnmarshalMap(itemMap, &bot)
+	if err != nil {
+		return bot, fmt.Errorf("Error when unpacking bot: %v", err)
+	}
+	return bot, nil
+}
+
+func (t BotTable) PutBot(b Bot) error {
+	return createItem(t, b, "Bot")
+}
+
+func (t BotTable) UpdateBot(b Bot) error {
+	return putItem(t, b)
+}
+
+func (t BotTable) DeleteBot(name string) error {
+	return deleteItem(t, name)
+}
+
+func (t BotTable) AllBots() ([]Bot, error) {
+	items, err := allItems(t)
+	if err != nil {
+		return nil, err
+	}
+	bots := make([]Bot, len(items))
+	for i, item := range items {
+		bot := Bot{}
+		err = attributevalue.UnmarshalMap(item, &bot)
+		if err != nil {
+			return bots, fmt.Errorf("Error when unpacking bot: %v", err)
+		}
+		bots[i] = bot
+	}
+	return bots, nil
+}
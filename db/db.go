@@ -95,6 +95,18 @@ func (i ItemNotFound) Error() string {
 	}
 }
 
+type ItemAlreadyExists struct {
+	ItemName string
+}
+
+func (i ItemAlreadyExists) Error() string {
+	if i.ItemName == "" {
+		return "Item already exists in database"
+	} else {
+		return fmt.Sprintf("%s already exists in database", i.ItemName)
+	}
+}
+
 func getItem(t Table, id string) (map[string]types.AttributeValue, error) {
 	input := &dynamodb.GetItemInput{
 		TableName: aws.String(t.Name()),
@@ -124,6 +136,28 @@ func putItem(t Table, item interface{}) error {
 	return nil
 }
 
+// like putItem, but fails with ItemAlreadyExists if an item with the same key is already in the table
+func createItem(t Table, item interface{}, itemName string) error {
+	itemMap, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("Error when packing item to be placed in table %s: %v", t.Name(), err)
+	}
+	_, err = t.Client().PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:                aws.String(t.Name()),
+		Item:                     itemMap,
+		ConditionExpression:      aws.String("attribute_not_exists(#key)"),
+		ExpressionAttributeNames: map[string]string{"#key": t.IndexName()},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ItemAlreadyExists{itemName}
+	}
+	if err != nil {
+		return fmt.Errorf("Error adding item to table %s: %v", t.Name(), err)
+	}
+	return nil
+}
+
 func updateItem(t Table, id string, updates map[string]interface{}) error {
 	update := expression.UpdateBuilder{}
 	for key, value := range updates {
@@ -175,9 +209,18 @@ func allItems(t Table) ([]map[string]types.AttributeValue, error) {
 	return output.Items, nil
 }
 
+// dynamodb storage
 type Tables struct {
 	Region string
 	UserTable
+	SnapshotTable
+	SessionTable
+	DenylistTable
+	LoginAttemptsTable
+	LoginAuditTable
+	IdentityTable
+	APITokenTable
+	BotTable
 }
 
 func GetTables(region string) (*Tables, error) {
@@ -190,6 +233,38 @@ func GetTables(region string) (*Tables, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error initializing user table: %v", err)
 	}
+	tables.SnapshotTable, err = MakeSnapshotTable(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing snapshot table: %v", err)
+	}
+	tables.SessionTable, err = MakeSessionTable(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing session table: %v", err)
+	}
+	tables.DenylistTable, err = MakeDenylistTable(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing denylist table: %v", err)
+	}
+	tables.LoginAttemptsTable, err = MakeLoginAttemptsTable(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing login attempts table: %v", err)
+	}
+	tables.LoginAuditTable, err = MakeLoginAuditTable(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing login audit table: %v", err)
+	}
+	tables.IdentityTable, err = MakeIdentityTable(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing identity table: %v", err)
+	}
+	tables.APITokenTable, err = MakeAPITokenTable(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing api token table: %v", err)
+	}
+	tables.BotTable, err = MakeBotTable(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing bot table: %v", err)
+	}
 	return &tables, nil
 }
 
@@ -199,6 +274,38 @@ func (t *Tables) Reset() error {
 	if err != nil {
 		return fmt.Errorf("Problem deleting user table: %v", err)
 	}
+	err = deleteTable(t.SnapshotTable)
+	if err != nil {
+		return fmt.Errorf("Problem deleting snapshot table: %v", err)
+	}
+	err = deleteTable(t.SessionTable)
+	if err != nil {
+		return fmt.Errorf("Problem deleting session table: %v", err)
+	}
+	err = deleteTable(t.DenylistTable)
+	if err != nil {
+		return fmt.Errorf("Problem deleting denylist table: %v", err)
+	}
+	err = deleteTable(t.LoginAttemptsTable)
+	if err != nil {
+		return fmt.Errorf("Problem deleting login attempts table: %v", err)
+	}
+	err = deleteTable(t.LoginAuditTable)
+	if err != nil {
+		return fmt.Errorf("Problem deleting login audit table: %v", err)
+	}
+	err = deleteTable(t.IdentityTable)
+	if err != nil {
+		return fmt.Errorf("Problem deleting identity table: %v", err)
+	}
+	err = deleteTable(t.APITokenTable)
+	if err != nil {
+		return fmt.Errorf("Problem deleting api token table: %v", err)
+	}
+	err = deleteTable(t.BotTable)
+	if err != nil {
+		return fmt.Errorf("Problem deleting bot table: %v", err)
+	}
 	newTables, err := GetTables(t.Region)
 	if err != nil {
 		return fmt.Errorf("Problem re-initializing tables: %v", err)
@@ -206,3 +313,7 @@ func (t *Tables) Reset() error {
 	*t = *newTables
 	return nil
 }
+
+func (t *Tables) Close() error {
+	return nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// links an account at an external identity provider to a user
+// users are looked up by name, so the link has to be moved when the user is renamed
+type Identity struct {
+	ID   string `json:"id"` // from IdentityID
+	User string `json:"user"`
+}
+
+// the provider's subject is only unique within its issuer
+func IdentityID(issuer string, subject string) string {
+	return issuer + "#" + subject
+}
+
+type IdentityStore interface {
+	GetIdentity(id string) (Identity, error)
+	// link a new identity; fails with ItemAlreadyExists if it's already linked
+	PutIdentity(i Identity) error
+	DeleteIdentity(id string) error
+}
+
+const IDENTITY_TABLE_NAME = "Bird.Identities"
+
+type IdentityTable struct {
+	client *dynamodb.Client
+}
+
+func (t IdentityTable) Client() *dynamodb.Client {
+	return t.client
+}
+
+func (t IdentityTable) Name() string {
+	return IDENTITY_TABLE_NAME
+}
+
+func (t IdentityTable) IndexName() string {
+	return "ID"
+}
+
+func (t IdentityTable) IndexType() types.ScalarAttributeType {
+	return types.ScalarAttributeTypeS
+}
+
+func MakeIdentityTable(client *dynamodb.Client) (IdentityTable, error) {
+	table := IdentityTable{client}
+	exists, err := tableIsInitialized(table)
+	if err != nil {
+		return table, fmt.Errorf("Error when checking if identity table exists: %v", err)
+	}
+	if exists {
+		return table, nil
+	} else {
+		err = initTable(table)
+		return table, err
+	}
+}
+
+func (t IdentityTable) GetIdentity(id string) (Identity, error) {
+	itemMap, err := getItem(t, id)
+	if err != nil {
+		return Identity{}, err
+	}
+	if itemMap == nil {
+		return Identity{}, ItemNotFound{"Identity"}
+	}
+	identity := Identity{}
+	err = attributevalue.UnmarshalMap(itemMap, &identity)
+	if err != nil {
+		return identity, fmt.Errorf("Error when unpacking identity: %v", err)
+	}
+	return identity, nil
+}
+
+func (t IdentityTable) PutIdentity(i Identity) error {
+	return createItem(t, i, "Identity")
+}
+
+func (t IdentityTable) DeleteIdentity(id string) error {
+	return deleteItem(t, id)
+}
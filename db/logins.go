@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// recent failed logins for one IP address or user name, used for rate limiting
+type LoginAttempts struct {
+	Key         string `json:"key"` // e.g. ip:1.2.3.4 or user:bob
+	Failures    int    `json:"failures"`
+	LastFailure int64  `json:"lastFailure"`
+	LockedUntil int64  `json:"lockedUntil"`
+}
+
+// record of a failed login
+type LoginAuditEntry struct {
+	ID     string `json:"id"`
+	Time   int64  `json:"time"`
+	Name   string `json:"name"`
+	IP     string `json:"ip"`
+	Reason string `json:"reason"`
+}
+
+type LoginLimitStore interface {
+	// returns empty attempts with the given key if none are stored
+	GetLoginAttempts(key string) (LoginAttempts, error)
+	PutLoginAttempts(a LoginAttempts) error
+	DeleteLoginAttempts(key string) error
+	AddLoginAudit(e LoginAuditEntry) error
+	// failed logins at or after since, oldest first
+	LoginAudit(since int64) ([]LoginAuditEntry, error)
+}
+
+// audit ids sort by time
+func NewLoginAuditEntry(name string, ip string, reason string) (LoginAuditEntry, error) {
+	now := time.Now()
+	suffix, err := RandomToken(6)
+	if err != nil {
+		return LoginAuditEntry{}, err
+	}
+	return LoginAuditEntry{
+		ID:     fmt.Sprintf("%020d-%s", now.UnixNano(), suffix),
+		Time:   now.Unix(),
+		Name:   name,
+		IP:     ip,
+		Reason: reason,
+	}, nil
+}
+
+const LOGIN_ATTEMPTS_TABLE_NAME = "Bird.LoginAttempts"
+
+type LoginAttemptsTable struct {
+	client *dynamodb.Client
+}
+
+func (t LoginAttemptsTable) Client() *dynamodb.Client {
+	return t.client
+}
+
+func (t LoginAttemptsTable) Name() string {
+	return LOGIN_ATTEMPTS_TABLE_NAME
+}
+
+func (t LoginAttemptsTable) IndexName() string {
+	return "Key"
+}
+
+func (t LoginAttemptsTable) IndexType() types.ScalarAttributeType {
+	return types.ScalarAttributeTypeS
+}
+
+func MakeLoginAttemptsTable(client *dynamodb.Client) (LoginAttemptsTable, error) {
+	table := LoginAttemptsTable{client}
+	exists, err := tableIsInitialized(table)
+	if err != nil {
+		return table, fmt.Errorf("Error when checking if login attempts table exists: %v", err)
+	}
+	if exists {
+		return table, nil
+	} else {
+		err = initTable(table)
+		return table, err
+	}
+}
+
+func (t LoginAttemptsTable) GetLoginAttempts(key string) (LoginAttempts, error) {
+	itemMap, err := getItem(t, key)
+	if err != nil {
+		return LoginAttempts{}, err
+	}
+	attempts := LoginAttempts{Key: key}
+	if itemMap == nil {
+		return attempts, nil
+	}
+	err = attributevalue.UnmarshalMap(itemMap, &attempts)
+	if err != nil {
+		return attempts, fmt.Errorf("Error when unpacking login attempts: %v", err)
+	}
+	return attempts, nil
+}
+
+func (t LoginAttemptsTable) PutLoginAttempts(a LoginAttempts) error {
+	return putItem(t, a)
+}
+
+func (t LoginAttemptsTable) DeleteLoginAttempts(key string) error {
+	return deleteItem(t, key)
+}
+
+const LOGIN_AUDIT_TABLE_NAME = "Bird.LoginAudit"
+
+type LoginAuditTable struct {
+	client *dynamodb.Client
+}
+
+func (t LoginAuditTable) Client() *dynamodb.Client {
+	return t.client
+}
+
+func (t LoginAuditTable) Name() string {
+	return LOGIN_AUDIT_TABLE_NAME
+}
+
+func (t LoginAuditTable) IndexName() string {
+	return "ID"
+}
+
+func (t LoginAuditTable) IndexType() types.ScalarAttributeType {
+	return types.ScalarAttributeTypeS
+}
+
+func MakeLoginAuditTable(client *dynamodb.Client) (LoginAuditTable, error) {
+	table := LoginAuditTable{client}
+	exists, err := tableIsInitialized(table)
+	if err != nil {
+		return table, fmt.Errorf("Error when checking if login audit table exists: %v", err)
+	}
+	if exists {
+		return table, nil
+	} else {
+		err = initTable(table)
+		return table, err
+	}
+}
+
+func (t LoginAuditTable) AddLoginAudit(e LoginAuditEntry) error {
+	return putItem(t, e)
+}
+
+func (t LoginAuditTable) LoginAudit(since int64) ([]LoginAuditEntry, error) {
+	entries := []LoginAuditEntry{}
+	paginator := dynamodb.NewScanPaginator(t.client, &dynamodb.ScanInput{
+		TableName:                aws.String(t.Name()),
+		FilterExpression:         aws.String("#time >= :since"),
+		ExpressionAttributeNames: map[string]string{"#time": "Time"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":since": &types.AttributeValueMemberN{Value: fmt.Sprint(since)},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("Error when scanning login audit: %v", err)
+		}
+		for _, item := range page.Items {
+			entry := LoginAuditEntry{}
+			if err := attributevalue.UnmarshalMap(item, &entry); err != nil {
+				return nil, fmt.Errorf("Error when unpacking login audit entry: %v", err)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
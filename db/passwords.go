@@ -0,0 +1,135 @@
+package db
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwords are stored as bcrypt hashes, which include their own salt
+// users created before hashing was introduced still have plaintext passwords,
+// which are re-hashed the next time they log in, or all at once with MigratePasswords
+
+const BCRYPT_COST = 12
+
+// bcrypt ignores anything past this
+const MAX_PASSWORD_LENGTH = 72
+
+type PasswordTooLong struct{}
+
+func (PasswordTooLong) Error() string {
+	return fmt.Sprintf("Password cannot be longer than %d bytes", MAX_PASSWORD_LENGTH)
+}
+
+func HashPassword(password string) (string, error) {
+	if len(password) > MAX_PASSWORD_LENGTH {
+		return "", PasswordTooLong{}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), BCRYPT_COST)
+	if err != nil {
+		return "", fmt.Errorf("Error when hashing password: %v", err)
+	}
+	return string(hash), nil
+}
+
+// make a user with a hashed password, ready to be stored
+// the name and password are checked against ValidateUserName and ValidatePassword
+func NewUser(name string, password string, admin bool) (User, error) {
+	if err := ValidateUserName(name); err != nil {
+		return User{}, err
+	}
+	if err := ValidatePassword(password); err != nil {
+		return User{}, err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	return User{Name: name, Password: hash, Admin: admin}, nil
+}
+
+// checked against when there's no real hash, so that a failed login takes as long whether or not the user exists
+// hashed at BCRYPT_COST from a password nobody uses
+const DUMMY_PASSWORD_HASH = "$2a$12$qd3Jq0vM0ktcQLJqiva/ZuWT8ITaHDzMVlU4JzVOsE9CdT5E6ghOi"
+
+// whether stored is a bcrypt hash, as opposed to a legacy plaintext password
+func isHashed(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// whether password matches the stored password, and whether the stored password should be re-hashed
+func checkPassword(stored string, password string) (ok bool, rehash bool) {
+	if stored == "" {
+		// users from an identity provider have no password to log in with
+		bcrypt.CompareHashAndPassword([]byte(DUMMY_PASSWORD_HASH), []byte(password))
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		// legacy plaintext
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+	ok = bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	return ok, ok && cost < BCRYPT_COST
+}
+
+func rehashPassword(s UserStore, name string, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return s.UpdateUser(name, map[string]interface{}{"Password": hash})
+}
+
+// hash every legacy plaintext password; returns the number of users migrated,
+// and the names of users whose passwords are too long to hash, who will need to have them reset
+func MigratePasswords(s UserStore) (int, []string, error) {
+	users, err := s.AllUsers()
+	if err != nil {
+		return 0, nil, err
+	}
+	migrated := 0
+	skipped := []string{}
+	for _, user := range users {
+		if user.Password == "" || isHashed(user.Password) {
+			continue
+		}
+		err := rehashPassword(s, user.Name, user.Password)
+		if _, tooLong := err.(PasswordTooLong); tooLong {
+			skipped = append(skipped, user.Name)
+			continue
+		}
+		if err != nil {
+			return migrated, skipped, fmt.Errorf("Error when migrating password for %s: %v", user.Name, err)
+		}
+		migrated++
+	}
+	return migrated, skipped, nil
+}
+
+// check that user exists and has correct password
+func validateUser(s UserStore, name string, password string) (bool, User, error) {
+	dbUser, err := s.GetUser(name)
+	if err != nil {
+		if _, ok := err.(ItemNotFound); ok {
+			checkPassword("", password)
+			return false, User{}, nil
+		}
+		return false, User{}, err
+	}
+	ok, rehash := checkPassword(dbUser.Password, password)
+	if !ok {
+		return false, User{}, nil
+	}
+	if rehash {
+		// not worth failing the login over
+		if err := rehashPassword(s, name, password); err != nil {
+			log.Printf("When re-hashing password for %s, got error %v", name, err)
+		}
+	}
+	return true, dbUser, nil
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestStore(t *testing.T) *BoltStore {
+	t.Helper()
+	s, err := OpenBoltStore(filepath.Join(t.TempDir(), "bird.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMigratePasswordsSkipsLongPasswords(t *testing.T) {
+	s := openTestStore(t)
+	long := strings.Repeat("x", MAX_PASSWORD_LENGTH+1)
+	legacy := []User{
+		{Name: "alice", Password: "alicepass"},
+		{Name: "bob", Password: long},
+		{Name: "carol", Password: "carolpass"},
+	}
+	for _, u := range legacy {
+		if err := s.PutUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrated, skipped, err := MigratePasswords(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 2 || len(skipped) != 1 || skipped[0] != "bob" {
+		t.Fatalf("migrated %d and skipped %v; expected 2 and [bob]", migrated, skipped)
+	}
+	for _, u := range legacy {
+		ok, _, err := s.ValidateUser(u.Name, u.Password)
+		if err != nil || !ok {
+			t.Fatalf("%s can't log in after migrating: %v", u.Name, err)
+		}
+	}
+	bob, err := s.GetUser("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Password != long {
+		t.Fatal("skipped user's password was changed")
+	}
+}
+
+func TestValidateMissingUser(t *testing.T) {
+	s := openTestStore(t)
+	ok, _, err := s.ValidateUser("nobody", "password")
+	if ok || err != nil {
+		t.Fatalf("got %v, %v for a user that doesn't exist", ok, err)
+	}
+}
@@ -0,0 +1,277 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// a login on one device; the client holds a refresh token, which is swapped for a new one every time it's used
+// the access token most recently issued for the session is recorded so it can be denied if the session is revoked
+type Session struct {
+	ID            string `json:"id"`
+	User          string `json:"user"`
+	RefreshHash   string `json:"refreshHash"` // sha256 of the current refresh secret
+	Created       int64  `json:"created"`
+	Expires       int64  `json:"expires"`
+	AccessJTI     string `json:"accessJti"`
+	AccessExpires int64  `json:"accessExpires"`
+}
+
+// an access token that must not be accepted, even though it hasn't expired
+type DeniedToken struct {
+	JTI     string `json:"jti"`
+	Expires int64  `json:"expires"`
+}
+
+type SessionStore interface {
+	GetSession(id string) (Session, error)
+	PutSession(s Session) error
+	DeleteSession(id string) error
+	// all unexpired sessions for the given user
+	UserSessions(user string) ([]Session, error)
+	DenyToken(t DeniedToken) error
+	// all unexpired denied tokens
+	DeniedTokens() ([]DeniedToken, error)
+}
+
+// random url-safe string made from n random bytes
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Error when generating random token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// start a new session for user; returns the session and its first refresh token
+func NewSession(user string, lifetime time.Duration) (Session, string, error) {
+	id, err := RandomToken(16)
+	if err != nil {
+		return Session{}, "", err
+	}
+	s := Session{
+		ID:      id,
+		User:    user,
+		Created: time.Now().Unix(),
+	}
+	token, err := s.Rotate(lifetime)
+	return s, token, err
+}
+
+// replace the session's refresh token with a new one, extending the session by lifetime
+func (s *Session) Rotate(lifetime time.Duration) (string, error) {
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	s.RefreshHash = hashSecret(secret)
+	s.Expires = time.Now().Add(lifetime).Unix()
+	return s.ID + "." + secret, nil
+}
+
+// whether secret is the session's current refresh secret
+func (s Session) CheckRefresh(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(s.RefreshHash), []byte(hashSecret(secret))) == 1
+}
+
+func (s Session) Expired() bool {
+	return time.Now().Unix() >= s.Expires
+}
+
+// split a refresh token into its session id and secret
+func ParseRefreshToken(token string) (id string, secret string, ok bool) {
+	return strings.Cut(token, ".")
+}
+
+// end the session, and deny the last access token issued for it
+func RevokeSession(store SessionStore, s Session) error {
+	if s.AccessJTI != "" && s.AccessExpires > time.Now().Unix() {
+		if err := store.DenyToken(DeniedToken{s.AccessJTI, s.AccessExpires}); err != nil {
+			return err
+		}
+	}
+	return store.DeleteSession(s.ID)
+}
+
+// end all of the user's sessions; returns the sessions revoked, even if a later one failed
+func RevokeUserSessions(store SessionStore, user string) ([]Session, error) {
+	sessions, err := store.UserSessions(user)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range sessions {
+		if err := RevokeSession(store, s); err != nil {
+			return sessions[:i], fmt.Errorf("Error when revoking session for %s: %v", user, err)
+		}
+	}
+	return sessions, nil
+}
+
+const SESSION_TABLE_NAME = "Bird.Sessions"
+
+type SessionTable struct {
+	client *dynamodb.Client
+}
+
+func (t SessionTable) Client() *dynamodb.Client {
+	return t.client
+}
+
+func (t SessionTable) Name() string {
+	return SESSION_TABLE_NAME
+}
+
+func (t SessionTable) IndexName() string {
+	return "ID"
+}
+
+func (t SessionTable) IndexType() types.ScalarAttributeType {
+	return types.ScalarAttributeTypeS
+}
+
+func MakeSessionTable(client *dynamodb.Client) (SessionTable, error) {
+	table := SessionTable{client}
+	exists, err := tableIsInitialized(table)
+	if err != nil {
+		return table, fmt.Errorf("Error when checking if session table exists: %v", err)
+	}
+	if exists {
+		return table, nil
+	} else {
+		err = initTable(table)
+		return table, err
+	}
+}
+
+func (t SessionTable) GetSession(id string) (Session, error) {
+	itemMap, err := getItem(t, id)
+	if err != nil {
+		return Session{}, err
+	}
+	if itemMap == nil {
+		return Session{}, ItemNotFound{"Session"}
+	}
+	session := Session{}
+	err = attributevalue.UnmarshalMap(itemMap, &session)
+	if err != nil {
+		return session, fmt.Errorf("Error when unpacking session: %v", err)
+	}
+	return session, nil
+}
+
+func (t SessionTable) PutSession(s Session) error {
+	return putItem(t, s)
+}
+
+func (t SessionTable) DeleteSession(id string) error {
+	return deleteItem(t, id)
+}
+
+func (t SessionTable) UserSessions(user string) ([]Session, error) {
+	sessions := []Session{}
+	paginator := dynamodb.NewScanPaginator(t.client, &dynamodb.ScanInput{
+		TableName:                aws.String(t.Name()),
+		FilterExpression:         aws.String("#user = :user"),
+		ExpressionAttributeNames: map[string]string{"#user": "User"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user": &types.AttributeValueMemberS{Value: user},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("Error when scanning sessions for %s: %v", user, err)
+		}
+		for _, item := range page.Items {
+			session := Session{}
+			if err := attributevalue.UnmarshalMap(item, &session); err != nil {
+				return nil, fmt.Errorf("Error when unpacking session: %v", err)
+			}
+			if !session.Expired() {
+				sessions = append(sessions, session)
+			}
+		}
+	}
+	return sessions, nil
+}
+
+const DENYLIST_TABLE_NAME = "Bird.Denylist"
+
+type DenylistTable struct {
+	client *dynamodb.Client
+}
+
+func (t DenylistTable) Client() *dynamodb.Client {
+	return t.client
+}
+
+func (t DenylistTable) Name() string {
+	return DENYLIST_TABLE_NAME
+}
+
+func (t DenylistTable) IndexName() string {
+	return "JTI"
+}
+
+func (t DenylistTable) IndexType() types.ScalarAttributeType {
+	return types.ScalarAttributeTypeS
+}
+
+func MakeDenylistTable(client *dynamodb.Client) (DenylistTable, error) {
+	table := DenylistTable{client}
+	exists, err := tableIsInitialized(table)
+	if err != nil {
+		return table, fmt.Errorf("Error when checking if denylist table exists: %v", err)
+	}
+	if exists {
+		return table, nil
+	} else {
+		err = initTable(table)
+		return table, err
+	}
+}
+
+func (t DenylistTable) DenyToken(token DeniedToken) error {
+	return putItem(t, token)
+}
+
+// expired tokens are removed from the table as they're found
+func (t DenylistTable) DeniedTokens() ([]DeniedToken, error) {
+	items, err := allItems(t)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	tokens := []DeniedToken{}
+	for _, item := range items {
+		token := DeniedToken{}
+		if err := attributevalue.UnmarshalMap(item, &token); err != nil {
+			return nil, fmt.Errorf("Error when unpacking denied token: %v", err)
+		}
+		if token.Expires <= now {
+			if err := deleteItem(t, token.JTI); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
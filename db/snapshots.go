@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// the saved state of a live lobby, auction, game or match, so it can be restored after a restart
+type Snapshot struct {
+	Key     string `json:"key"` // Kind/ID
+	Kind    string `json:"kind"`
+	ID      string `json:"id"`
+	Data    string `json:"data"` // json-encoded item
+	Updated int64  `json:"updated"`
+}
+
+const SNAPSHOT_TABLE_NAME = "Bird.Snapshots"
+
+type SnapshotTable struct {
+	client *dynamodb.Client
+}
+
+func (t SnapshotTable) Client() *dynamodb.Client {
+	return t.client
+}
+
+func (t SnapshotTable) Name() string {
+	return SNAPSHOT_TABLE_NAME
+}
+
+func (t SnapshotTable) IndexName() string {
+	return "Key"
+}
+
+func (t SnapshotTable) IndexType() types.ScalarAttributeType {
+	return types.ScalarAttributeTypeS
+}
+
+func MakeSnapshotTable(client *dynamodb.Client) (SnapshotTable, error) {
+	table := SnapshotTable{client}
+	exists, err := tableIsInitialized(table)
+	if err != nil {
+		return table, fmt.Errorf("Error when checking if snapshot table exists: %v", err)
+	}
+	if exists {
+		return table, nil
+	} else {
+		err = initTable(table)
+		return table, err
+	}
+}
+
+func snapshotKey(kind string, id string) string {
+	return kind + "/" + id
+}
+
+func (t SnapshotTable) SaveSnapshot(kind string, id string, data []byte) error {
+	return putItem(t, Snapshot{
+		Key:     snapshotKey(kind, id),
+		Kind:    kind,
+		ID:      id,
+		Data:    string(data),
+		Updated: time.Now().Unix(),
+	})
+}
+
+func (t SnapshotTable) DeleteSnapshot(kind string, id string) error {
+	return deleteItem(t, snapshotKey(kind, id))
+}
+
+// all saved snapshots of the given kind
+func (t SnapshotTable) LoadSnapshots(kind string) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	paginator := dynamodb.NewScanPaginator(t.client, &dynamodb.ScanInput{
+		TableName:                aws.String(t.Name()),
+		FilterExpression:         aws.String("#kind = :kind"),
+		ExpressionAttributeNames: map[string]string{"#kind": "Kind"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":kind": &types.AttributeValueMemberS{Value: kind},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("Error when scanning snapshots of kind %s: %v", kind, err)
+		}
+		for _, item := range page.Items {
+			snapshot := Snapshot{}
+			if err := attributevalue.UnmarshalMap(item, &snapshot); err != nil {
+				return nil, fmt.Errorf("Error when unpacking snapshot: %v", err)
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
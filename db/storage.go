@@ -0,0 +1,102 @@
+package db
+
+import (
+	"fmt"
+	"os"
+)
+
+// storage backends can be chosen with these environment variables
+const STORAGE_ENV = "BIRD_STORAGE"
+const AWS_REGION_ENV = "BIRD_AWS_REGION"
+const DB_PATH_ENV = "BIRD_DB_PATH"
+
+const (
+	DYNAMODB_STORAGE = "dynamodb"
+	BOLT_STORAGE     = "bolt"
+)
+
+const DEFAULT_AWS_REGION = "us-east-1"
+const DEFAULT_DB_PATH = "bird.db"
+
+type UserStore interface {
+	GetUser(name string) (User, error)
+	// add a new user; fails with ItemAlreadyExists if the name is taken
+	PutUser(u User) error
+	UpdateUser(name string, updates map[string]interface{}) error
+	DeleteUser(name string) error
+	// move a user, and any identity linked to it, to a new name; fails with ItemAlreadyExists if the new name is taken
+	RenameUser(oldName string, newName string) error
+	UserExists(name string) (bool, error)
+	ValidateUser(name string, password string) (bool, User, error)
+	AllUsers() ([]User, error)
+}
+
+// somewhere to keep live lobbies, games etc., so they survive restarts
+type SnapshotStore interface {
+	SaveSnapshot(kind string, id string, data []byte) error
+	DeleteSnapshot(kind string, id string) error
+	LoadSnapshots(kind string) ([]Snapshot, error)
+}
+
+// everything the server keeps between restarts
+type Storage interface {
+	UserStore
+	SnapshotStore
+	SessionStore
+	LoginLimitStore
+	IdentityStore
+	APITokenStore
+	BotStore
+	// delete everything and start over
+	Reset() error
+	Close() error
+}
+
+type StorageConfig struct {
+	Backend string
+	// for DYNAMODB_STORAGE
+	Region string
+	// for BOLT_STORAGE
+	Path string
+}
+
+// read storage config from the environment, defaulting to dynamodb
+func StorageConfigFromEnv() StorageConfig {
+	config := StorageConfig{
+		Backend: os.Getenv(STORAGE_ENV),
+		Region:  os.Getenv(AWS_REGION_ENV),
+		Path:    os.Getenv(DB_PATH_ENV),
+	}
+	if config.Backend == "" {
+		config.Backend = DYNAMODB_STORAGE
+	}
+	if config.Region == "" {
+		config.Region = DEFAULT_AWS_REGION
+	}
+	if config.Path == "" {
+		config.Path = DEFAULT_DB_PATH
+	}
+	return config
+}
+
+func OpenStorage(config StorageConfig) (Storage, error) {
+	switch config.Backend {
+	case DYNAMODB_STORAGE:
+		return GetTables(config.Region)
+	case BOLT_STORAGE:
+		return OpenBoltStore(config.Path)
+	default:
+		return nil, fmt.Errorf("Unknown storage backend %q; expected %q or %q", config.Backend, DYNAMODB_STORAGE, BOLT_STORAGE)
+	}
+}
+
+func userExists(s UserStore, name string) (bool, error) {
+	_, err := s.GetUser(name)
+	if err != nil {
+		if _, ok := err.(ItemNotFound); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -1,8 +1,11 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
@@ -10,8 +13,9 @@ import (
 
 type User struct {
 	Name     string `json:"name"`
-	Password string `json:"password"`
+	Password string `json:"password"` // empty for users who sign in with an identity provider
 	Admin    bool   `json:"admin"`
+	Identity string `json:"identity,omitempty"` // id of the linked Identity, if any
 }
 
 const USER_TABLE_NAME = "Bird.Users"
@@ -69,8 +73,9 @@ func (t UserTable) GetUser(uname string) (User, error) {
 	return user, nil
 }
 
+// add a new user; fails with ItemAlreadyExists if the name is taken
 func (t UserTable) PutUser(u User) error {
-	return putItem(t, u)
+	return createItem(t, u, "User")
 }
 
 func (t UserTable) UpdateUser(uname string, updates map[string]interface{}) error {
@@ -81,34 +86,70 @@ func (t UserTable) DeleteUser(name string) error {
 	return deleteItem(t, name)
 }
 
-// check that user exists and has correct password
-func (t UserTable) ValidateUser(name string, password string) (bool, User, error) {
-	dbUser, err := t.GetUser(name)
+// put the user under the new name and delete the old one in a single transaction,
+// on the condition that the new name is free and the old one still exists
+// a linked identity is moved to the new name in the same transaction
+func (t UserTable) RenameUser(oldName string, newName string) error {
+	user, err := t.GetUser(oldName)
 	if err != nil {
-		if _, ok := err.(ItemNotFound); ok {
-			return false, User{}, nil
+		return err
+	}
+	user.Name = newName
+	itemMap, err := attributevalue.MarshalMap(user)
+	if err != nil {
+		return fmt.Errorf("Error when packing renamed user: %v", err)
+	}
+	writes := []types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:                aws.String(t.Name()),
+			Item:                     itemMap,
+			ConditionExpression:      aws.String("attribute_not_exists(#name)"),
+			ExpressionAttributeNames: map[string]string{"#name": t.IndexName()},
+		}},
+		{Delete: &types.Delete{
+			TableName: aws.String(t.Name()),
+			Key: map[string]types.AttributeValue{
+				t.IndexName(): &types.AttributeValueMemberS{Value: oldName},
+			},
+			ConditionExpression:      aws.String("attribute_exists(#name)"),
+			ExpressionAttributeNames: map[string]string{"#name": t.IndexName()},
+		}},
+	}
+	if user.Identity != "" {
+		identityMap, err := attributevalue.MarshalMap(Identity{ID: user.Identity, User: newName})
+		if err != nil {
+			return fmt.Errorf("Error when packing identity: %v", err)
 		}
-		return false, User{}, err
+		writes = append(writes, types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String(IDENTITY_TABLE_NAME),
+			Item:      identityMap,
+		}})
 	}
-	ok := dbUser.Password == password
-	var user User
-	if ok {
-		user = dbUser
-	} else {
-		user = User{}
+	_, err = t.client.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+		TransactItems: writes,
+	})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) && len(canceled.CancellationReasons) >= 2 {
+		if aws.ToString(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+			return ItemAlreadyExists{"User"}
+		}
+		if aws.ToString(canceled.CancellationReasons[1].Code) == "ConditionalCheckFailed" {
+			return ItemNotFound{"User"}
+		}
 	}
-	return ok, user, nil
+	if err != nil {
+		return fmt.Errorf("Error when renaming user %s: %v", oldName, err)
+	}
+	return nil
+}
+
+// check that user exists and has correct password
+func (t UserTable) ValidateUser(name string, password string) (bool, User, error) {
+	return validateUser(t, name, password)
 }
 
 func (t UserTable) UserExists(name string) (bool, error) {
-	_, err := t.GetUser(name)
-	if err != nil {
-		if _, ok := err.(ItemNotFound); ok {
-			return false, nil
-		}
-		return false, err
-	}
-	return true, nil
+	return userExists(t, name)
 }
 
 func (t UserTable) AllUsers() ([]User, error) {
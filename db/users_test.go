@@ -0,0 +1,38 @@
+package db
+
+import "testing"
+
+func TestRenameUserMovesIdentity(t *testing.T) {
+	s := openTestStore(t)
+	identity := Identity{ID: IdentityID("https://issuer", "subject"), User: "alice"}
+	if err := s.PutUser(User{Name: "alice", Identity: identity.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutIdentity(identity); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutUser(User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.RenameUser("alice", "bob").(ItemAlreadyExists); !ok {
+		t.Fatal("renamed onto a name that's taken")
+	}
+	if got, _ := s.GetIdentity(identity.ID); got.User != "alice" {
+		t.Fatalf("failed rename moved identity to %s", got.User)
+	}
+
+	if err := s.RenameUser("alice", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUser("alice"); err == nil {
+		t.Fatal("old name still exists after renaming")
+	}
+	got, err := s.GetIdentity(identity.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.User != "carol" {
+		t.Fatalf("identity points at %s after renaming to carol", got.User)
+	}
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const MIN_NAME_LENGTH = 3
+const MAX_NAME_LENGTH = 24
+
+// names show up in urls, so stick to characters that don't need escaping
+var NAME_PATTERN = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+const MIN_PASSWORD_LENGTH = 8
+
+type InvalidUserInput struct {
+	Reason string
+}
+
+func (e InvalidUserInput) Error() string {
+	return e.Reason
+}
+
+func ValidateUserName(name string) error {
+	if len(name) < MIN_NAME_LENGTH || len(name) > MAX_NAME_LENGTH {
+		return InvalidUserInput{fmt.Sprintf("Name must be between %d and %d characters long", MIN_NAME_LENGTH, MAX_NAME_LENGTH)}
+	}
+	if !NAME_PATTERN.MatchString(name) {
+		return InvalidUserInput{"Name can only contain letters, numbers, '_', '.' and '-'"}
+	}
+	return nil
+}
+
+// rules for new passwords; existing passwords are accepted as they are
+func ValidatePassword(password string) error {
+	if len(password) < MIN_PASSWORD_LENGTH {
+		return InvalidUserInput{fmt.Sprintf("Password must be at least %d characters long", MIN_PASSWORD_LENGTH)}
+	}
+	if len(password) > MAX_PASSWORD_LENGTH {
+		return PasswordTooLong{}
+	}
+	return nil
+}
@@ -9,71 +9,105 @@ import (
 )
 
 type BidState struct {
-	ID            string    `json:"id"`
-	Done          bool      `json:"done"`
-	Players       [4]string `json:"players"`
-	Hands         [4][]Card `json:"hands"`
-	Widow         [5]Card   `json:"widow"`
-	Passed        [4]bool   `json:"passed"`
-	CurrentBidder int       `json:"currentBidder"`
-	Bid           int       `json:"bid"`
+	ID            string            `json:"id"`
+	Done          bool              `json:"done"`
+	Players       [4]string         `json:"players"`
+	Hands         [4][]Card         `json:"hands"`
+	Widow         []Card            `json:"widow"`
+	Passed        [4]bool           `json:"passed"`
+	CurrentBidder int               `json:"currentBidder"`
+	Bid           int               `json:"bid"`
+	HighBidder    int               `json:"highBidder"` // seat that made the current bid, or -1
+	Rules         Rules             `json:"rules"`
+	Bots          [4]string         `json:"bots"`
+	Disconnected  [4]bool           `json:"disconnected"`
+	Spectating    SpectatorSettings `json:"spectating"`
+	Spectators    []string          `json:"spectators"`
 }
 
 func (b BidState) GetID() string {
 	return b.ID
 }
 
+// player is -1 for spectators, who see everyone's hands only if kibitzing is on
 func (b BidState) Visible(player int) interface{} {
-	return VisibleBidState{
+	v := VisibleBidState{
 		ID:            b.ID,
 		Done:          b.Done,
 		Players:       b.Players,
-		Hand:          b.Hands[player],
 		Passed:        b.Passed,
 		CurrentBidder: b.CurrentBidder,
 		Bid:           b.Bid,
-	}
+		HighBidder:    b.HighBidder,
+		Rules:         b.Rules,
+		Bots:          b.Bots,
+		Disconnected:  b.Disconnected,
+		Spectators:    b.Spectators,
+	}
+	if player >= 0 {
+		v.Hand = b.Hands[player]
+	} else if b.Spectating.Kibitz {
+		v.Hands = b.Hands[:]
+	}
+	return v
 }
 
 func (b BidState) GetPlayers() []string {
 	return b.Players[:]
 }
 
-func deal() ([4][]Card, [5]Card) {
-	// get all cards
-	allCards := []Card{Bird}
-	for suite := Red; suite <= Black; suite++ {
-		for value := 1; value <= 14; value++ {
-			allCards = append(allCards, Card{suite, value})
-		}
-	}
+func deal(rules Rules) ([4][]Card, []Card) {
+	allCards := rules.Deck()
 	// get random indices and distribute cards
 	rand.Seed(time.Now().UnixNano())
 	perm := rand.Perm(len(allCards))
 	hands := [4][]Card{}
-	widow := [5]Card{}
+	widow := make([]Card, 0, rules.WidowSize)
 	for i, j := range perm {
 		card := allCards[j]
-		if i < 5 {
-			widow[i] = card
+		if i < rules.WidowSize {
+			widow = append(widow, card)
 			continue
 		}
-		rem := (i - 5 + 4) % 4
+		rem := (i - rules.WidowSize) % 4
 		hands[rem] = append(hands[rem], card)
 	}
 	return hands, widow
 }
 
-func InitializeBidState(id string, players [4]string) BidState {
-	hands, widow := deal()
+func InitializeBidState(id string, players [4]string, firstBidder int, rules Rules, bots [4]string) BidState {
+	hands, widow := deal(rules)
 	return BidState{
-		ID:      id,
-		Players: players,
-		Hands:   hands,
-		Widow:   widow,
+		ID:            id,
+		Players:       players,
+		Hands:         hands,
+		Widow:         widow,
+		CurrentBidder: firstBidder,
+		HighBidder:    -1,
+		Rules:         rules,
+		Bots:          bots,
+		Spectating:    DefaultSpectatorSettings(),
+		Spectators:    []string{},
 	}
 }
 
+func (b *BidState) SetConnected(player string, connected bool) {
+	b.Spectators = setConnected(b.Players, &b.Disconnected, b.Spectators, player, connected)
+}
+
+func (b *BidState) ResetConnections() {
+	resetConnections(b.Players, &b.Disconnected)
+	b.Spectators = []string{}
+}
+
+func (b BidState) AllowsSpectators() bool {
+	return b.Spectating.Allowed
+}
+
+func (b BidState) SpectatorDelay() time.Duration {
+	return b.Spectating.delay()
+}
+
 func (b BidState) HasPlayer(player string) bool {
 	return utils.Contains(b.Players[:], player)
 }
@@ -108,9 +142,6 @@ func (b *BidState) AdvanceBidder() {
 		b.Done = true
 	}
 	b.CurrentBidder = nextBidder
-	if b.Players[b.CurrentBidder] == "" {
-		b.setAIBid()
-	}
 }
 
 func (b *BidState) ProcessBid(player string, amt int) error {
@@ -134,14 +165,14 @@ func (b *BidState) ProcessBid(player string, amt int) error {
 	if b.Passed[playerIndex] {
 		return fmt.Errorf("Bidder already passed")
 	}
-	if amt < 0 || amt > 200 {
-		return fmt.Errorf("Invalid bid amount")
-	}
-
 	if amt <= b.Bid {
 		b.Passed[playerIndex] = true
 	} else {
+		if err := b.Rules.ValidateBid(amt, b.Bid); err != nil {
+			return err
+		}
 		b.Bid = amt
+		b.HighBidder = playerIndex
 	}
 	b.AdvanceBidder()
 
@@ -162,6 +193,12 @@ func (b BidState) InitGame() (GameState, error) {
 		Bid:           b.Bid,
 		BidWinner:     b.CurrentBidder,
 		Table:         []Card{},
+		Tricks:        []Trick{},
+		Rules:         b.Rules,
+		Bots:          b.Bots,
+		Disconnected:  b.Disconnected,
+		Spectating:    b.Spectating,
+		Spectators:    b.Spectators,
 	}, nil
 }
 
@@ -173,46 +210,23 @@ type VisibleBidState struct {
 	Passed        [4]bool   `json:"passed"`
 	CurrentBidder int       `json:"currentBidder"`
 	Bid           int       `json:"bid"`
+	HighBidder    int       `json:"highBidder"`
+	Rules         Rules     `json:"rules"`
+	Bots          [4]string `json:"bots"`
+	Disconnected  [4]bool   `json:"disconnected"`
+	Spectators    []string  `json:"spectators"`
+	// everyone's hands, only sent to kibitzers
+	Hands [][]Card `json:"hands,omitempty"`
 }
 
-func (b *BidState) setAIBid() {
-	value := handValue(b.Hands[b.CurrentBidder])
-	fmt.Printf("Player %d has hand value %d\n", b.CurrentBidder, value)
-	if b.Bid < value {
-		rem := value % 5
-		b.Bid = value + (5 - rem)
-	} else {
-		b.Passed[b.CurrentBidder] = true
-	}
-	b.AdvanceBidder()
-}
-
-func handValue(h []Card) int {
-	total := 0
-	colorCounts := make(map[Color]int)
-	colorCounts[Red] = 0
-	colorCounts[Yellow] = 0
-	colorCounts[Green] = 0
-	colorCounts[Black] = 0
-	for _, card := range h {
-		if card.Value == 1 {
-			total += 15
-		} else if card.Value == 0 {
-			colorCounts[Red]++
-			colorCounts[Yellow]++
-			colorCounts[Green]++
-			colorCounts[Black]++
-		} else {
-			total += card.Value
-			colorCounts[card.Color]++
-		}
-	}
-	maxColorCount := 0
-	for _, count := range colorCounts {
-		if count > maxColorCount {
-			maxColorCount = count
-		}
+// what the player in seat is allowed to know about the auction
+func (b BidState) bidView(seat int) BidView {
+	return BidView{
+		Seat:       seat,
+		Hand:       append([]Card{}, b.Hands[seat]...),
+		Passed:     b.Passed,
+		Bid:        b.Bid,
+		HighBidder: b.HighBidder,
+		Rules:      b.Rules,
 	}
-	total += maxColorCount * 5
-	return total
 }
@@ -0,0 +1,131 @@
+package game
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// bots don't move as part of the change that hands them the turn, since deciding can be slow
+// (a search, or a request to an external bot) and the state is locked while it changes
+// instead, the owner of the state gets the pending move from NextBotMove, decides it with no locks held,
+// and hands the decision back to ApplyBotMove
+
+// a decision the bot whose turn it is has to make; exactly one of the views is set
+type BotMove struct {
+	Seat     int
+	Strategy string
+	Bid      *BidView
+	Widow    *WidowView
+	Play     *PlayView
+}
+
+// what a bot decided; only the fields for the kind of move are used
+type BotDecision struct {
+	Move      BotMove
+	Bid       int
+	Trump     Color
+	ToWidow   []Card
+	FromWidow []Card
+	Card      Card
+}
+
+// the state changed between asking a bot for a move and applying its decision
+type StaleBotMove struct{}
+
+func (StaleBotMove) Error() string {
+	return "The bot's move is no longer wanted"
+}
+
+// ask the seat's strategy what to do; may take a while
+func (m BotMove) Decide() BotDecision {
+	strategy := GetStrategy(m.Strategy)
+	d := BotDecision{Move: m}
+	switch {
+	case m.Bid != nil:
+		d.Bid = strategy.Bid(*m.Bid)
+	case m.Widow != nil:
+		d.Trump = strategy.ChooseTrump(*m.Widow)
+		d.ToWidow, d.FromWidow = strategy.ExchangeWidow(*m.Widow, d.Trump)
+	case m.Play != nil:
+		d.Card = strategy.PlayCard(*m.Play)
+	}
+	return d
+}
+
+// whether d was decided for the move that's pending now
+// views never repeat within a hand, so an equal view means nothing has happened since
+func (d BotDecision) isFor(pending BotMove, ok bool) bool {
+	return ok && reflect.DeepEqual(pending, d.Move)
+}
+
+// the bid a bot has to make, if it's a bot's turn
+func (b BidState) NextBotMove() (BotMove, bool) {
+	if b.Done || b.Players[b.CurrentBidder] != "" {
+		return BotMove{}, false
+	}
+	view := b.bidView(b.CurrentBidder)
+	return BotMove{Seat: b.CurrentBidder, Strategy: b.Bots[b.CurrentBidder], Bid: &view}, true
+}
+
+// make a bid decided for NextBotMove; fails with StaleBotMove if the auction has moved on
+func (b *BidState) ApplyBotMove(d BotDecision) error {
+	if !d.isFor(b.NextBotMove()) {
+		return StaleBotMove{}
+	}
+	if d.Bid > b.Bid && b.Rules.ValidateBid(d.Bid, b.Bid) == nil {
+		b.Bid = d.Bid
+		b.HighBidder = b.CurrentBidder
+	} else {
+		b.Passed[b.CurrentBidder] = true
+	}
+	b.AdvanceBidder()
+	return nil
+}
+
+// the move a bot has to make, if it's a bot's turn:
+// choosing trump and exchanging with the widow if it won the bid, otherwise playing a card
+func (g GameState) NextBotMove() (BotMove, bool) {
+	if g.Done {
+		return BotMove{}, false
+	}
+	if g.Trump == Color(0) {
+		if g.Players[g.BidWinner] != "" {
+			return BotMove{}, false
+		}
+		view := g.widowView()
+		return BotMove{Seat: g.BidWinner, Strategy: g.Bots[g.BidWinner], Widow: &view}, true
+	}
+	if g.Players[g.CurrentPlayer] != "" {
+		return BotMove{}, false
+	}
+	view := g.playView(g.CurrentPlayer)
+	if len(view.Legal) == 0 {
+		// the trick is waiting to be finished
+		return BotMove{}, false
+	}
+	return BotMove{Seat: g.CurrentPlayer, Strategy: g.Bots[g.CurrentPlayer], Play: &view}, true
+}
+
+// make a move decided for NextBotMove; fails with StaleBotMove if the game has moved on
+// impossible decisions are swapped for safe ones rather than failing
+func (g *GameState) ApplyBotMove(d BotDecision) error {
+	if !d.isFor(g.NextBotMove()) {
+		return StaleBotMove{}
+	}
+	if view := d.Move.Widow; view != nil {
+		if g.StartRound(d.Trump, d.ToWidow, d.FromWidow) == nil {
+			return nil
+		}
+		// strategy asked for something impossible; keep the hand as dealt
+		return g.StartRound(chooseAITrump(view.Hand), nil, nil)
+	}
+	view := d.Move.Play
+	card := d.Card
+	if !utils.Contains(view.Legal, card) {
+		log.Printf("Bot in seat %d chose illegal card %v; playing %v instead", d.Move.Seat, card, view.Legal[0])
+		card = view.Legal[0]
+	}
+	return g.PlayCard(d.Move.Seat, card)
+}
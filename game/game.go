@@ -2,6 +2,7 @@ package game
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/quevivasbien/bird-game/utils"
 )
@@ -22,91 +23,128 @@ type Card struct {
 	Value int   `json:"value"`
 }
 
-func (c Card) Beats(other Card, trump Color) bool {
-	if c.Color != other.Color {
-		if c.Color == trump || c == Bird {
-			return true
-		} else {
-			return false
-		}
-	}
-	return c.Value == 1 || (other.Value != 1 && c.Value > other.Value)
-}
-
-func (c Card) Score() int {
-	switch c.Value {
-	case 1:
-		return 15
-	case 13:
-		return 10
-	case 10:
-		return 10
-	case 5:
-		return 5
-	case Bird.Value:
-		return 20
-	default:
-		return 0
+// color the card counts as during play; the Bird is always trump
+func (c Card) EffectiveColor(trump Color) Color {
+	if c == Bird {
+		return trump
 	}
+	return c.Color
 }
 
 var Bird Card = Card{0, 0}
 
+// a completed trick; Cards are in the order they were played, starting with Leader
+type Trick struct {
+	Leader int    `json:"leader"`
+	Cards  []Card `json:"cards"`
+	Winner int    `json:"winner"`
+}
+
 type GameState struct {
-	ID            string    `json:"id"`
-	Players       [4]string `json:"players"`
-	Hands         [4][]Card `json:"hands"`
-	Discarded     [2][]Card `json:"discarded"`
-	Widow         [5]Card   `json:"widow"`
-	Table         []Card    `json:"table"`
-	CurrentPlayer int       `json:"currentPlayer"`
-	LastWinner    int       `json:"lastWinner"`
-	Trump         Color     `json:"trump"`
-	Bid           int       `json:"bid"`
-	BidWinner     int       `json:"bidWinner"`
-	Done          bool      `json:"done"`
+	ID            string            `json:"id"`
+	Players       [4]string         `json:"players"`
+	Hands         [4][]Card         `json:"hands"`
+	Discarded     [2][]Card         `json:"discarded"`
+	Widow         []Card            `json:"widow"`
+	Table         []Card            `json:"table"`
+	Tricks        []Trick           `json:"tricks"`
+	CurrentPlayer int               `json:"currentPlayer"`
+	LastWinner    int               `json:"lastWinner"`
+	Trump         Color             `json:"trump"`
+	Bid           int               `json:"bid"`
+	BidWinner     int               `json:"bidWinner"`
+	Done          bool              `json:"done"`
+	Rules         Rules             `json:"rules"`
+	Bots          [4]string         `json:"bots"`
+	Disconnected  [4]bool           `json:"disconnected"`
+	Spectating    SpectatorSettings `json:"spectating"`
+	Spectators    []string          `json:"spectators"`
 }
 
 func (g GameState) GetID() string {
 	return g.ID
 }
 
+// player is -1 for spectators, who see everyone's hands only if kibitzing is on
 func (g GameState) Visible(player int) interface{} {
-	return VisibleGameState{
+	v := VisibleGameState{
 		ID:            g.ID,
 		Players:       g.Players,
-		Hand:          g.Hands[player],
 		DiscardSize:   [2]int{len(g.Discarded[0]), len(g.Discarded[1])},
 		Table:         g.Table,
+		Tricks:        g.Tricks,
 		CurrentPlayer: g.CurrentPlayer,
 		LastWinner:    g.LastWinner,
 		Trump:         g.Trump,
 		Bid:           g.Bid,
 		BidWinner:     g.BidWinner,
 		Done:          g.Done,
+		Rules:         g.Rules,
+		Bots:          g.Bots,
+		Disconnected:  g.Disconnected,
+		Spectators:    g.Spectators,
 	}
+	if player >= 0 {
+		v.Hand = g.Hands[player]
+	} else if g.Spectating.Kibitz {
+		v.Hands = g.Hands[:]
+	}
+	return v
 }
 
 func (g GameState) GetPlayers() []string {
 	return g.Players[:]
 }
 
+func (g *GameState) SetConnected(player string, connected bool) {
+	g.Spectators = setConnected(g.Players, &g.Disconnected, g.Spectators, player, connected)
+}
+
+func (g *GameState) ResetConnections() {
+	resetConnections(g.Players, &g.Disconnected)
+	g.Spectators = []string{}
+}
+
+func (g GameState) AllowsSpectators() bool {
+	return g.Spectating.Allowed
+}
+
+func (g GameState) SpectatorDelay() time.Duration {
+	return g.Spectating.delay()
+}
+
 func (g GameState) HasPlayer(player string) bool {
 	return utils.Contains(g.Players[:], player)
 }
 
+// exchange cards with the widow, set trump, and let the bid winner lead
+func (g *GameState) StartRound(trump Color, toWidow []Card, fromWidow []Card) error {
+	if g.Trump != Color(0) {
+		return fmt.Errorf("Round has already started")
+	}
+	if trump < Red || trump > Black {
+		return fmt.Errorf("Invalid trump color %d", trump)
+	}
+	if err := g.ExchangeWithWidow(toWidow, fromWidow); err != nil {
+		return err
+	}
+	g.Trump = trump
+	return nil
+}
+
 func (g *GameState) ExchangeWithWidow(toWidow []Card, fromWidow []Card) error {
 	if len(toWidow) != len(fromWidow) {
 		return fmt.Errorf("Tried to take and give different amounts of cards from the widow")
 	}
-	newWidow := g.Widow // copy so we don't make changes if something is wrong
-	newHand := g.Hands[g.BidWinner]
+	// copy so we don't make changes if something is wrong
+	newWidow := append([]Card{}, g.Widow...)
+	newHand := append([]Card{}, g.Hands[g.BidWinner]...)
 	for i := range toWidow {
 		handIndex := utils.IndexOf(newHand, toWidow[i])
 		if handIndex == -1 {
 			return fmt.Errorf("Tried to put a card in the widow that was not in the bin winner's hand")
 		}
-		widowIndex := utils.IndexOf(newWidow[:], fromWidow[i])
+		widowIndex := utils.IndexOf(newWidow, fromWidow[i])
 		if widowIndex == -1 {
 			return fmt.Errorf("Tried to take a card from the widow that was not in the widow")
 		}
@@ -117,25 +155,121 @@ func (g *GameState) ExchangeWithWidow(toWidow []Card, fromWidow []Card) error {
 	return nil
 }
 
-func (g *GameState) PlayCard(playerIndex int, card Card) error {
-	cards := g.Hands[playerIndex]
-	cardIndex := utils.IndexOf(cards, card)
-	if cardIndex == -1 {
-		return fmt.Errorf("Card is not in player's hand")
+type NotPlayersTurn struct {
+	Player        int
+	CurrentPlayer int
+}
+
+func (e NotPlayersTurn) Error() string {
+	return fmt.Sprintf("It is not player %d's turn; waiting on player %d", e.Player, e.CurrentPlayer)
+}
+
+type CardNotInHand struct {
+	Card Card
+}
+
+func (e CardNotInHand) Error() string {
+	return "Card is not in player's hand"
+}
+
+type MustFollowSuit struct {
+	Led Color
+}
+
+func (e MustFollowSuit) Error() string {
+	return fmt.Sprintf("Player has a card of the led color (%d) and must play it", e.Led)
+}
+
+type TableFull struct{}
+
+func (e TableFull) Error() string {
+	return "All players have already played. Call FinishPlay before playing more cards."
+}
+
+type RoundNotStarted struct{}
+
+func (e RoundNotStarted) Error() string {
+	return "Trump has not been chosen yet"
+}
+
+type GameOver struct{}
+
+func (e GameOver) Error() string {
+	return "Game is already finished"
+}
+
+// the color that must be followed in the current trick, or 0 if no card has been led
+func (g GameState) LeadColor() Color {
+	if len(g.Table) == 0 {
+		return Color(0)
+	}
+	return g.Table[0].EffectiveColor(g.Trump)
+}
+
+// check that it is playerIndex's turn and that the game is in a state where cards can be played
+func (g GameState) checkTurn(playerIndex int) error {
+	if g.Done {
+		return GameOver{}
+	}
+	if g.Trump == Color(0) {
+		return RoundNotStarted{}
 	}
 	if len(g.Table) == 4 {
-		return fmt.Errorf("All players have already played. Call FinishPlay before playing more cards.")
+		return TableFull{}
+	}
+	if playerIndex != g.CurrentPlayer {
+		return NotPlayersTurn{playerIndex, g.CurrentPlayer}
+	}
+	return nil
+}
+
+// cards in player's hand that can legally be played right now
+// returns an empty list if it is not the player's turn
+func (g GameState) LegalMoves(playerIndex int) []Card {
+	if g.checkTurn(playerIndex) != nil {
+		return []Card{}
+	}
+	hand := g.Hands[playerIndex]
+	led := g.LeadColor()
+	following := []Card{}
+	for _, card := range hand {
+		if card.EffectiveColor(g.Trump) == led {
+			following = append(following, card)
+		}
+	}
+	if len(following) == 0 {
+		// leading, or can't follow suit; anything goes
+		return append([]Card{}, hand...)
+	}
+	return following
+}
+
+// check that playing card is allowed by the rules, without changing the game state
+func (g GameState) ValidatePlay(playerIndex int, card Card) error {
+	if err := g.checkTurn(playerIndex); err != nil {
+		return err
+	}
+	if !utils.Contains(g.Hands[playerIndex], card) {
+		return CardNotInHand{card}
+	}
+	if !utils.Contains(g.LegalMoves(playerIndex), card) {
+		return MustFollowSuit{g.LeadColor()}
+	}
+	return nil
+}
+
+func (g *GameState) PlayCard(playerIndex int, card Card) error {
+	if err := g.ValidatePlay(playerIndex, card); err != nil {
+		return err
 	}
 	g.Table = append(g.Table, card)
-	g.Hands[playerIndex] = utils.Remove(g.Hands[playerIndex], cardIndex)
+	// earlier versions of the game kept for replays share the hand's backing array, so don't change it in place
+	g.Hands[playerIndex] = utils.Without(g.Hands[playerIndex], card)
 	if len(g.Table) == 4 {
 		// host should call FinishPlay now
 		return nil
 	}
 	g.CurrentPlayer = (g.CurrentPlayer + 1 + 4) % 4
-	if g.Players[g.CurrentPlayer] == "" {
-		g.playAICard()
-	}
 	return nil
 }
 
@@ -145,16 +279,13 @@ func (g *GameState) FinishPlay() error {
 		return fmt.Errorf("Attempted to finish a play before all players have played")
 	}
 	// figure out winner
-	winner := (g.CurrentPlayer + 1) % 4
-	bestCard := g.Table[0]
-	for i := 1; i <= 3; i++ {
-		player := (g.CurrentPlayer + 1 + i + 4) % 4
-		card := g.Table[i]
-		if card.Beats(bestCard, g.Trump) {
-			winner = player
-			bestCard = card
-		}
-	}
+	leader := (g.CurrentPlayer + 1) % 4
+	winner, _ := trickWinner(g.Table, leader, g.Trump, g.Rules)
+	g.Tricks = append(g.Tricks, Trick{
+		Leader: leader,
+		Cards:  append([]Card{}, g.Table...),
+		Winner: winner,
+	})
 	g.CurrentPlayer = winner
 	g.LastWinner = winner
 	// remove cards from table
@@ -173,32 +304,57 @@ func (g *GameState) FinishPlay() error {
 	}
 	if done {
 		g.Done = done
-		// add widow to hand of winner of this play
-		if winner%2 == 0 {
-			g.Discarded[0] = append(g.Discarded[0], g.Widow[:]...)
-		} else {
-			g.Discarded[1] = append(g.Discarded[1], g.Widow[:]...)
+		// add widow to the pile of the winner of this play, or of the bidding team
+		widowTeam := g.BidWinner % 2
+		if g.Rules.WidowToLastTrick {
+			widowTeam = winner % 2
 		}
-	} else if g.Players[winner] == "" {
-		g.playAICard()
+		g.Discarded[widowTeam] = append(g.Discarded[widowTeam], g.Widow...)
 	}
 	return nil
 }
 
+// breakdown of the score for a finished hand
+type HandResult struct {
+	CardPoints [2]int `json:"cardPoints"` // points from counters taken by each team
+	Bonus      [2]int `json:"bonus"`      // bonuses for taking the most cards and the last trick
+	Points     [2]int `json:"points"`     // card points plus bonus
+	Scores     [2]int `json:"scores"`     // points after applying the bid contract
+	BidTeam    int    `json:"bidTeam"`
+	Bid        int    `json:"bid"`
+	Made       bool   `json:"made"` // false if the bidding team was set
+}
+
 // if game is done (all hands empty), calculate score for each team
-func (g *GameState) Score() (int, int, error) {
+// the bidding team loses the amount of its bid if it falls short; otherwise both teams keep their points
+func (g *GameState) Score() (HandResult, error) {
 	if !g.Done {
-		return -1, -1, fmt.Errorf("Cannot calculate score before game is finished")
+		return HandResult{}, fmt.Errorf("Cannot calculate score before game is finished")
+	}
+	result := HandResult{
+		BidTeam: g.BidWinner % 2,
+		Bid:     g.Bid,
+	}
+	for team, cards := range g.Discarded {
+		for _, card := range cards {
+			result.CardPoints[team] += g.Rules.CardPoints(card)
+		}
 	}
-	score0 := 0
-	for _, card := range g.Discarded[0] {
-		score0 += card.Score()
+	if len(g.Discarded[0]) > len(g.Discarded[1]) {
+		result.Bonus[0] += g.Rules.MostCardsBonus
+	} else if len(g.Discarded[1]) > len(g.Discarded[0]) {
+		result.Bonus[1] += g.Rules.MostCardsBonus
 	}
-	if len(g.Hands[0]) > len(g.Hands[1]) {
-		score0 += 20
+	result.Bonus[g.LastWinner%2] += g.Rules.LastTrickBonus
+	for team := range result.Points {
+		result.Points[team] = result.CardPoints[team] + result.Bonus[team]
 	}
-	score1 := 200 - score0
-	return score0, score1, nil
+	result.Scores = result.Points
+	result.Made = result.Points[result.BidTeam] >= g.Bid
+	if !result.Made {
+		result.Scores[result.BidTeam] = -g.Bid
+	}
+	return result, nil
 }
 
 // state of the game visible to a player during the game
@@ -208,46 +364,48 @@ type VisibleGameState struct {
 	Hand          []Card    `json:"hand"`
 	DiscardSize   [2]int    `json:"discardSize"`
 	Table         []Card    `json:"table"`
+	Tricks        []Trick   `json:"tricks"`
 	CurrentPlayer int       `json:"currentPlayer"`
 	LastWinner    int       `json:"lastWinner"`
 	Trump         Color     `json:"trump"`
 	Bid           int       `json:"bid"`
 	BidWinner     int       `json:"bidWinner"`
 	Done          bool      `json:"done"`
+	Rules         Rules     `json:"rules"`
+	Bots          [4]string `json:"bots"`
+	Disconnected  [4]bool   `json:"disconnected"`
+	Spectators    []string  `json:"spectators"`
+	// everyone's hands, only sent to kibitzers
+	Hands [][]Card `json:"hands,omitempty"`
 }
 
-func (g *GameState) playAICard() {
-	leadingColor := Color(0)
-	if len(g.Table) > 0 {
-		leadingColor = g.Table[0].Color
-		if leadingColor == Color(0) {
-			leadingColor = g.Trump
-		}
-	}
-	hand := g.Hands[g.CurrentPlayer]
-	haveLeading := leadingColor == Color(0)
-	haveTrump := false
-	for _, card := range hand {
-		if card.Color != 0 && card.Color == leadingColor {
-			haveLeading = true
-		}
-		if card.Color == 0 || card.Color == g.Trump {
-			haveTrump = true
-		}
+// what the bid winner knows when choosing trump and exchanging with the widow
+func (g GameState) widowView() WidowView {
+	return WidowView{
+		Seat:  g.BidWinner,
+		Hand:  append([]Card{}, g.Hands[g.BidWinner]...),
+		Widow: append([]Card{}, g.Widow...),
+		Bid:   g.Bid,
+		Rules: g.Rules,
 	}
+}
 
-	chosen := hand[0]
-	for _, card := range hand {
-		if card.Color != leadingColor && !haveLeading {
-			if card.Color == g.Trump {
-				chosen = card
-			} else if !haveTrump {
-				chosen = card
-			}
-		}
-		if card.Color == leadingColor {
-			chosen = card
-		}
+// what the player in seat is allowed to know about the game
+func (g GameState) playView(seat int) PlayView {
+	view := PlayView{
+		Seat:      seat,
+		Hand:      append([]Card{}, g.Hands[seat]...),
+		Table:     append([]Card{}, g.Table...),
+		Leader:    g.LastWinner,
+		Tricks:    g.Tricks,
+		Trump:     g.Trump,
+		Bid:       g.Bid,
+		BidWinner: g.BidWinner,
+		Legal:     g.LegalMoves(seat),
+		Rules:     g.Rules,
+	}
+	if seat == g.BidWinner {
+		view.Widow = append([]Card{}, g.Widow...)
 	}
-	g.PlayCard(g.CurrentPlayer, chosen)
+	return view
 }
@@ -0,0 +1,195 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+// a hand in progress with red as trump, where seat is to play onto table
+func inPlay(seat int, table []Card, hands [4][]Card) GameState {
+	leader := (seat - len(table) + 4) % 4
+	return GameState{
+		Players:       [4]string{"a", "b", "c", "d"},
+		Hands:         hands,
+		Table:         table,
+		CurrentPlayer: seat,
+		LastWinner:    leader,
+		Trump:         Red,
+		Bid:           120,
+		Rules:         DefaultRules(),
+	}
+}
+
+var (
+	red5    = Card{Red, 5}
+	red14   = Card{Red, 14}
+	yellow1 = Card{Yellow, 1}
+	yellow9 = Card{Yellow, 9}
+	green10 = Card{Green, 10}
+	black2  = Card{Black, 2}
+)
+
+func TestLegalMovesAndValidatePlay(t *testing.T) {
+	tests := []struct {
+		name  string
+		game  GameState
+		seat  int
+		legal []Card
+		// what ValidatePlay returns for card; nil if it's allowed
+		card Card
+		err  error
+	}{
+		{
+			name:  "leading, anything goes",
+			game:  inPlay(0, []Card{}, [4][]Card{{red5, yellow9, Bird}}),
+			seat:  0,
+			legal: []Card{red5, yellow9, Bird},
+			card:  yellow9,
+		},
+		{
+			name:  "must follow the led color",
+			game:  inPlay(1, []Card{yellow1}, [4][]Card{{}, {red5, yellow9, green10}}),
+			seat:  1,
+			legal: []Card{yellow9},
+			card:  green10,
+			err:   MustFollowSuit{Yellow},
+		},
+		{
+			name:  "can't follow, anything goes",
+			game:  inPlay(1, []Card{yellow1}, [4][]Card{{}, {red5, green10, Bird}}),
+			seat:  1,
+			legal: []Card{red5, green10, Bird},
+			card:  green10,
+		},
+		{
+			name:  "Bird led counts as trump",
+			game:  inPlay(1, []Card{Bird}, [4][]Card{{}, {red5, yellow9, red14}}),
+			seat:  1,
+			legal: []Card{red5, red14},
+			card:  yellow9,
+			err:   MustFollowSuit{Red},
+		},
+		{
+			name:  "Bird led and no trump, anything goes",
+			game:  inPlay(1, []Card{Bird}, [4][]Card{{}, {yellow9, green10}}),
+			seat:  1,
+			legal: []Card{yellow9, green10},
+			card:  green10,
+		},
+		{
+			name:  "Bird follows a trump lead",
+			game:  inPlay(2, []Card{red14, red5}, [4][]Card{{}, {}, {yellow9, Bird}}),
+			seat:  2,
+			legal: []Card{Bird},
+			card:  Bird,
+		},
+		{
+			name:  "Bird can't follow another color",
+			game:  inPlay(2, []Card{yellow1, black2}, [4][]Card{{}, {}, {yellow9, Bird}}),
+			seat:  2,
+			legal: []Card{yellow9},
+			card:  Bird,
+			err:   MustFollowSuit{Yellow},
+		},
+		{
+			name:  "out of turn",
+			game:  inPlay(1, []Card{yellow1}, [4][]Card{{}, {yellow9}, {green10}}),
+			seat:  2,
+			legal: []Card{},
+			card:  green10,
+			err:   NotPlayersTurn{2, 1},
+		},
+		{
+			name:  "card not in hand",
+			game:  inPlay(0, []Card{}, [4][]Card{{red5}}),
+			seat:  0,
+			legal: []Card{red5},
+			card:  red14,
+			err:   CardNotInHand{red14},
+		},
+		{
+			name:  "trick waiting to be finished",
+			game:  inPlay(3, []Card{red5, red14, yellow1, black2}, [4][]Card{{}, {}, {}, {green10}}),
+			seat:  3,
+			legal: []Card{},
+			card:  green10,
+			err:   TableFull{},
+		},
+	}
+	for _, test := range tests {
+		if legal := test.game.LegalMoves(test.seat); !reflect.DeepEqual(legal, test.legal) {
+			t.Errorf("%s: legal moves are %v, expected %v", test.name, legal, test.legal)
+		}
+		if err := test.game.ValidatePlay(test.seat, test.card); err != test.err {
+			t.Errorf("%s: playing %v gave %v, expected %v", test.name, test.card, err, test.err)
+		}
+	}
+}
+
+func TestPlayBeforeRoundOrAfterGame(t *testing.T) {
+	g := inPlay(0, []Card{}, [4][]Card{{red5}})
+	g.Trump = Color(0)
+	if err := g.ValidatePlay(0, red5); err != (RoundNotStarted{}) {
+		t.Errorf("playing before trump is chosen gave %v", err)
+	}
+	g = inPlay(0, []Card{}, [4][]Card{{red5}})
+	g.Done = true
+	if err := g.ValidatePlay(0, red5); err != (GameOver{}) {
+		t.Errorf("playing after the game is over gave %v", err)
+	}
+}
+
+func TestPlayCardMovesTurn(t *testing.T) {
+	g := inPlay(3, []Card{}, [4][]Card{{}, {}, {}, {red5, yellow9}})
+	if err := g.PlayCard(3, yellow9); err != nil {
+		t.Fatal(err)
+	}
+	if g.CurrentPlayer != 0 {
+		t.Errorf("turn passed to %d, not 0", g.CurrentPlayer)
+	}
+	if !reflect.DeepEqual(g.Hands[3], []Card{red5}) || !reflect.DeepEqual(g.Table, []Card{yellow9}) {
+		t.Errorf("after playing, hand is %v and table is %v", g.Hands[3], g.Table)
+	}
+}
+
+func TestPlayCardLeavesEarlierVersionsAlone(t *testing.T) {
+	g := inPlay(0, []Card{}, [4][]Card{{red5, yellow9, green10}})
+	before := g
+	if err := g.PlayCard(0, red5); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before.Hands[0], []Card{red5, yellow9, green10}) {
+		t.Errorf("playing changed the hand of the earlier version to %v", before.Hands[0])
+	}
+}
+
+func TestTrickWinnerWithBird(t *testing.T) {
+	redAce := Card{Red, 1}
+	red10 := Card{Red, 10}
+	red11 := Card{Red, 11}
+	red2 := Card{Red, 2}
+	tests := []struct {
+		name   string
+		rank   BirdRank
+		table  []Card
+		winner int
+	}{
+		{"high Bird beats the ace of trump", BirdHigh, []Card{redAce, Bird, red14, red5}, 1},
+		{"low Bird loses to the 2 of trump", BirdLow, []Card{yellow1, Bird, red2, yellow9}, 2},
+		{"low Bird still beats other colors", BirdLow, []Card{yellow1, Bird, yellow9, green10}, 1},
+		{"Bird between 10 and 11 beats the 10", BirdTenHalf, []Card{red10, Bird, red5, yellow1}, 1},
+		{"Bird between 10 and 11 loses to the 11", BirdTenHalf, []Card{red11, Bird, red5, yellow1}, 0},
+		{"off-color cards don't win", BirdHigh, []Card{yellow9, green10, yellow1, black2}, 2},
+	}
+	for _, test := range tests {
+		// seat 0 led, and seat 3 has just played
+		g := inPlay(3, test.table, [4][]Card{{red5}})
+		g.Rules.BirdRank = test.rank
+		if err := g.FinishPlay(); err != nil {
+			t.Fatal(err)
+		}
+		if g.LastWinner != test.winner {
+			t.Errorf("%s: seat %d won %v, expected seat %d", test.name, g.LastWinner, test.table, test.winner)
+		}
+	}
+}
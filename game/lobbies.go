@@ -1,18 +1,36 @@
 package game
 
-import "github.com/quevivasbien/bird-game/utils"
+import (
+	"time"
+
+	"github.com/quevivasbien/bird-game/utils"
+)
 
 type Lobby struct {
 	ID      string    `json:"id"`
 	Host    string    `json:"host"`
 	Players [4]string `json:"players"`
+	Rules   Rules     `json:"rules"`
+	// names of strategies used by bots in empty seats
+	Bots [4]string `json:"bots"`
+	// seats whose player has lost their connection
+	Disconnected [4]bool           `json:"disconnected"`
+	Spectating   SpectatorSettings `json:"spectating"`
+	// names of people watching who aren't playing
+	Spectators []string `json:"spectators"`
+	// set when the lobby is made and never changed, so checking each player as they sit down
+	// is enough to keep guests out
+	Ranked bool `json:"ranked"`
 }
 
 func MakeLobby(id string, host string) Lobby {
 	return Lobby{
-		ID:      id,
-		Host:    host,
-		Players: [4]string{host},
+		ID:         id,
+		Host:       host,
+		Players:    [4]string{host},
+		Rules:      DefaultRules(),
+		Spectating: DefaultSpectatorSettings(),
+		Spectators: []string{},
 	}
 }
 
@@ -28,6 +46,24 @@ func (l Lobby) GetPlayers() []string {
 	return l.Players[:]
 }
 
+func (l *Lobby) SetConnected(player string, connected bool) {
+	l.Spectators = setConnected(l.Players, &l.Disconnected, l.Spectators, player, connected)
+}
+
+func (l *Lobby) ResetConnections() {
+	resetConnections(l.Players, &l.Disconnected)
+	l.Spectators = []string{}
+}
+
+func (l Lobby) AllowsSpectators() bool {
+	return l.Spectating.Allowed
+}
+
+// the lobby has nothing secret in it, so there's no need to hold it back
+func (l Lobby) SpectatorDelay() time.Duration {
+	return 0
+}
+
 func (l Lobby) HasPlayer(player string) bool {
 	return utils.Contains(l.Players[:], player)
 }
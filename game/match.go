@@ -0,0 +1,145 @@
+package game
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+const DEFAULT_MATCH_TARGET = 500
+const DEFAULT_MATCH_LIMIT = -250
+
+// summary of a completed hand within a match
+type HandRecord struct {
+	FirstBidder int    `json:"firstBidder"`
+	BidWinner   int    `json:"bidWinner"`
+	Bid         int    `json:"bid"`
+	Made        bool   `json:"made"`
+	Scores      [2]int `json:"scores"`
+}
+
+// a series of hands played by the same players until one team reaches the target score
+// or a team falls to the negative limit
+type Match struct {
+	ID          string            `json:"id"`
+	Players     [4]string         `json:"players"`
+	Target      int               `json:"target"`
+	Limit       int               `json:"limit"`
+	Scores      [2]int            `json:"scores"`
+	History     []HandRecord      `json:"history"`
+	FirstBidder int               `json:"firstBidder"`
+	InHand      bool              `json:"inHand"`
+	Done        bool              `json:"done"`
+	Winner      int               `json:"winner"`
+	Rules       Rules             `json:"rules"`
+	Bots        [4]string         `json:"bots"`
+	Spectating  SpectatorSettings `json:"spectating"`
+	Ranked      bool              `json:"ranked"`
+}
+
+// start a match with the players, rules and bots set up in a lobby
+func MakeMatch(lobby Lobby, target int, limit int) (Match, error) {
+	if target <= 0 {
+		return Match{}, fmt.Errorf("Match target score must be positive")
+	}
+	if limit >= 0 {
+		return Match{}, fmt.Errorf("Match lower limit must be negative")
+	}
+	return Match{
+		ID:         lobby.ID,
+		Players:    lobby.Players,
+		Target:     target,
+		Limit:      limit,
+		History:    []HandRecord{},
+		Winner:     -1,
+		Rules:      lobby.Rules,
+		Bots:       lobby.Bots,
+		Spectating: lobby.Spectating,
+		Ranked:     lobby.Ranked,
+	}, nil
+}
+
+func (m Match) GetID() string {
+	return m.ID
+}
+
+func (m Match) Visible(int) interface{} {
+	return m
+}
+
+func (m Match) GetPlayers() []string {
+	return m.Players[:]
+}
+
+func (m Match) AllowsSpectators() bool {
+	return m.Spectating.Allowed
+}
+
+// match scores are public, so there's no need to hold them back
+func (m Match) SpectatorDelay() time.Duration {
+	return 0
+}
+
+func (m Match) HasPlayer(player string) bool {
+	return utils.Contains(m.Players[:], player)
+}
+
+// deal the next hand of the match, rotating the first bidder each hand
+func (m *Match) NextHand() (BidState, error) {
+	if m.Done {
+		return BidState{}, fmt.Errorf("Cannot start a new hand after the match is finished")
+	}
+	if m.InHand {
+		return BidState{}, fmt.Errorf("Cannot start a new hand before the current hand is finished")
+	}
+	m.FirstBidder = len(m.History) % 4
+	m.InHand = true
+	b := InitializeBidState(m.ID, m.Players, m.FirstBidder, m.Rules, m.Bots)
+	b.Spectating = m.Spectating
+	return b, nil
+}
+
+// add the score from a finished hand to the match totals and check whether the match is over
+func (m *Match) RecordHand(g GameState) error {
+	if !m.InHand {
+		return fmt.Errorf("Tried to record a hand when no hand is in progress")
+	}
+	result, err := g.Score()
+	if err != nil {
+		return err
+	}
+	m.History = append(m.History, HandRecord{
+		FirstBidder: m.FirstBidder,
+		BidWinner:   g.BidWinner,
+		Bid:         g.Bid,
+		Made:        result.Made,
+		Scores:      result.Scores,
+	})
+	m.Scores[0] += result.Scores[0]
+	m.Scores[1] += result.Scores[1]
+	m.InHand = false
+	m.checkDone(g.BidWinner % 2)
+	return nil
+}
+
+// the match ends when a team reaches the target or drops to the limit;
+// if both teams reach the target on the same hand, the bidding team wins
+func (m *Match) checkDone(bidTeam int) {
+	reached := [2]bool{m.Scores[0] >= m.Target, m.Scores[1] >= m.Target}
+	switch {
+	case reached[0] && reached[1]:
+		m.Winner = bidTeam
+	case reached[0]:
+		m.Winner = 0
+	case reached[1]:
+		m.Winner = 1
+	case m.Scores[0] <= m.Limit:
+		m.Winner = 1
+	case m.Scores[1] <= m.Limit:
+		m.Winner = 0
+	default:
+		return
+	}
+	m.Done = true
+}
@@ -0,0 +1,154 @@
+package game
+
+import "fmt"
+
+// where the Bird ranks among trump cards
+type BirdRank int
+
+const (
+	BirdHigh    BirdRank = iota // beats every other trump
+	BirdLow                     // loses to every other trump
+	BirdTenHalf                 // beats the 10 of trump but loses to the 11
+)
+
+// house rules for a game; set by the lobby host before bidding starts
+type Rules struct {
+	MinBid       int      `json:"minBid"`
+	BidIncrement int      `json:"bidIncrement"`
+	MaxBid       int      `json:"maxBid"`
+	BirdRank     BirdRank `json:"birdRank"`
+	BirdPoints   int      `json:"birdPoints"`
+	WidowSize    int      `json:"widowSize"`
+	// if true, the widow goes to whoever wins the last trick; otherwise it goes to the bidding team
+	WidowToLastTrick bool `json:"widowToLastTrick"`
+	// number of low cards removed from each color, starting from the 2s
+	LowCardsRemoved int `json:"lowCardsRemoved"`
+	MostCardsBonus  int `json:"mostCardsBonus"`
+	LastTrickBonus  int `json:"lastTrickBonus"`
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		MinBid:           100,
+		BidIncrement:     5,
+		MaxBid:           200,
+		BirdRank:         BirdHigh,
+		BirdPoints:       20,
+		WidowSize:        5,
+		WidowToLastTrick: true,
+		LowCardsRemoved:  0,
+		MostCardsBonus:   20,
+		LastTrickBonus:   0,
+	}
+}
+
+// check that the rules describe a playable game
+func (r Rules) Validate() error {
+	if r.BidIncrement <= 0 {
+		return fmt.Errorf("Bid increment must be positive")
+	}
+	if r.MinBid <= 0 || r.MaxBid < r.MinBid {
+		return fmt.Errorf("Minimum bid must be positive and no greater than the maximum bid")
+	}
+	if r.BirdRank < BirdHigh || r.BirdRank > BirdTenHalf {
+		return fmt.Errorf("Unknown Bird rank %d", r.BirdRank)
+	}
+	if r.BirdPoints < 0 || r.MostCardsBonus < 0 || r.LastTrickBonus < 0 {
+		return fmt.Errorf("Point values cannot be negative")
+	}
+	if r.LowCardsRemoved < 0 || r.LowCardsRemoved > 4 {
+		return fmt.Errorf("Can remove between 0 and 4 low cards from each color")
+	}
+	deckSize := len(r.Deck())
+	if r.WidowSize < 0 || r.WidowSize >= deckSize {
+		return fmt.Errorf("Invalid widow size")
+	}
+	if (deckSize-r.WidowSize)%4 != 0 {
+		return fmt.Errorf("Widow size %d would not leave an equal number of cards for each player", r.WidowSize)
+	}
+	return nil
+}
+
+// all cards in play under these rules
+func (r Rules) Deck() []Card {
+	cards := []Card{Bird}
+	for color := Red; color <= Black; color++ {
+		cards = append(cards, Card{color, 1})
+		for value := 2 + r.LowCardsRemoved; value <= 14; value++ {
+			cards = append(cards, Card{color, value})
+		}
+	}
+	return cards
+}
+
+// total points available from counters in the deck, not including bonuses
+func (r Rules) DeckPoints() int {
+	total := 0
+	for _, card := range r.Deck() {
+		total += r.CardPoints(card)
+	}
+	return total
+}
+
+func (r Rules) CardPoints(c Card) int {
+	if c == Bird {
+		return r.BirdPoints
+	}
+	switch c.Value {
+	case 1:
+		return 15
+	case 13:
+		return 10
+	case 10:
+		return 10
+	case 5:
+		return 5
+	default:
+		return 0
+	}
+}
+
+// rank of a card within its color; higher ranks win
+// values are doubled so that the Bird can sit between the 10 and 11
+func (r Rules) rank(c Card) int {
+	if c == Bird {
+		switch r.BirdRank {
+		case BirdLow:
+			return 0
+		case BirdTenHalf:
+			return 21
+		default:
+			return 32
+		}
+	}
+	if c.Value == 1 {
+		return 30
+	}
+	return 2 * c.Value
+}
+
+// whether c beats the currently winning card other
+func (r Rules) Beats(c Card, other Card, trump Color) bool {
+	color, otherColor := c.EffectiveColor(trump), other.EffectiveColor(trump)
+	if color != otherColor {
+		return color == trump
+	}
+	return r.rank(c) > r.rank(other)
+}
+
+// check that amt is an allowed bid, given that the highest bid so far is current
+func (r Rules) ValidateBid(amt int, current int) error {
+	if amt > r.MaxBid {
+		return fmt.Errorf("Bid cannot be more than %d", r.MaxBid)
+	}
+	if amt < r.MinBid {
+		return fmt.Errorf("Bid must be at least %d", r.MinBid)
+	}
+	if amt%r.BidIncrement != 0 {
+		return fmt.Errorf("Bid must be a multiple of %d", r.BidIncrement)
+	}
+	if current != 0 && amt < current+r.BidIncrement {
+		return fmt.Errorf("Bid must raise the current bid by at least %d", r.BidIncrement)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// a finished hand where each team took the given cards
+func finished(bidWinner int, bid int, lastWinner int, taken [2][]Card) GameState {
+	return GameState{
+		Discarded:  taken,
+		Done:       true,
+		Trump:      Red,
+		Bid:        bid,
+		BidWinner:  bidWinner,
+		LastWinner: lastWinner,
+		Rules:      DefaultRules(),
+	}
+}
+
+func TestScore(t *testing.T) {
+	// 15 + 10 + 10 + 5 + 20 = 60 points in five cards, and 0 points in three
+	counters := []Card{{Red, 1}, {Red, 13}, {Yellow, 10}, {Green, 5}, Bird}
+	blanks := []Card{{Black, 2}, {Black, 3}, {Black, 4}}
+	tests := []struct {
+		name   string
+		game   GameState
+		result HandResult
+	}{
+		{
+			name: "contract made, most cards bonus to bidders",
+			game: finished(0, 80, 1, [2][]Card{counters, blanks}),
+			result: HandResult{
+				CardPoints: [2]int{60, 0},
+				Bonus:      [2]int{20, 0},
+				Points:     [2]int{80, 0},
+				Scores:     [2]int{80, 0},
+				BidTeam:    0,
+				Bid:        80,
+				Made:       true,
+			},
+		},
+		{
+			name: "contract set, bidders lose their bid",
+			game: finished(1, 100, 1, [2][]Card{counters, blanks}),
+			result: HandResult{
+				CardPoints: [2]int{60, 0},
+				Bonus:      [2]int{20, 0},
+				Points:     [2]int{80, 0},
+				Scores:     [2]int{80, -100},
+				BidTeam:    1,
+				Bid:        100,
+				Made:       false,
+			},
+		},
+		{
+			name: "most cards bonus can make the contract",
+			game: finished(3, 20, 0, [2][]Card{counters[:2], append(blanks, counters[2:]...)}),
+			result: HandResult{
+				CardPoints: [2]int{25, 35},
+				Bonus:      [2]int{0, 20},
+				Points:     [2]int{25, 55},
+				Scores:     [2]int{25, 55},
+				BidTeam:    1,
+				Bid:        20,
+				Made:       true,
+			},
+		},
+		{
+			name: "no most cards bonus for a tie",
+			game: finished(2, 40, 0, [2][]Card{counters[:3], append(blanks, counters[3:]...)[:3]}),
+			result: HandResult{
+				CardPoints: [2]int{35, 0},
+				Bonus:      [2]int{0, 0},
+				Points:     [2]int{35, 0},
+				Scores:     [2]int{-40, 0},
+				BidTeam:    0,
+				Bid:        40,
+				Made:       false,
+			},
+		},
+	}
+	for _, test := range tests {
+		result, err := test.game.Score()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("%s: got %+v, expected %+v", test.name, result, test.result)
+		}
+	}
+}
+
+func TestScoreLastTrickBonus(t *testing.T) {
+	g := finished(0, 50, 3, [2][]Card{{{Red, 1}, {Red, 2}}, {{Red, 3}}})
+	g.Rules.LastTrickBonus = 10
+	result, err := g.Score()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Bonus != [2]int{20, 10} {
+		t.Errorf("bonuses are %v, expected most cards to team 0 and last trick to team 1", result.Bonus)
+	}
+}
+
+func TestScoreBeforeDone(t *testing.T) {
+	g := finished(0, 50, 0, [2][]Card{})
+	g.Done = false
+	if _, err := g.Score(); err == nil {
+		t.Error("scored a hand that isn't finished")
+	}
+}
+
+func TestWidowGoesToLastTrick(t *testing.T) {
+	for _, toLastTrick := range []bool{true, false} {
+		// seat 0 leads the last trick and wins it, while seat 1 won the bid
+		g := inPlay(3, []Card{red14, {Red, 2}, {Red, 3}}, [4][]Card{{}, {}, {}, {red5}})
+		g.BidWinner = 1
+		g.Widow = []Card{{Black, 1}}
+		g.Rules.WidowToLastTrick = toLastTrick
+		if err := g.PlayCard(3, red5); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.FinishPlay(); err != nil {
+			t.Fatal(err)
+		}
+		if !g.Done {
+			t.Fatal("game isn't done after the last trick")
+		}
+		team := 1
+		if toLastTrick {
+			team = 0
+		}
+		if !utils.Contains(g.Discarded[team], Card{Black, 1}) || utils.Contains(g.Discarded[1-team], Card{Black, 1}) {
+			t.Errorf("with WidowToLastTrick %v, widow didn't go to team %d: %v", toLastTrick, team, g.Discarded)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package game
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// default number of seconds kibitzers lag behind the game
+const DEFAULT_KIBITZ_DELAY = 30
+
+const MAX_KIBITZ_DELAY = 600
+
+// who can watch a table without playing, and what they get to see
+type SpectatorSettings struct {
+	// let people who aren't playing subscribe to the lobby, auction and game
+	Allowed bool `json:"allowed"`
+	// show spectators everyone's hands, KibitzDelay seconds behind the live game
+	Kibitz      bool `json:"kibitz"`
+	KibitzDelay int  `json:"kibitzDelay"`
+}
+
+// tables are private unless the host lets spectators in
+func DefaultSpectatorSettings() SpectatorSettings {
+	return SpectatorSettings{
+		Allowed:     false,
+		KibitzDelay: DEFAULT_KIBITZ_DELAY,
+	}
+}
+
+func (s SpectatorSettings) Validate() error {
+	if s.KibitzDelay < 0 || s.KibitzDelay > MAX_KIBITZ_DELAY {
+		return fmt.Errorf("Kibitz delay must be between 0 and %d seconds", MAX_KIBITZ_DELAY)
+	}
+	if s.Kibitz && !s.Allowed {
+		return fmt.Errorf("Cannot allow kibitzing without allowing spectators")
+	}
+	return nil
+}
+
+// how long updates should be held back from spectators
+func (s SpectatorSettings) delay() time.Duration {
+	if !s.Kibitz {
+		return 0
+	}
+	return time.Duration(s.KibitzDelay) * time.Second
+}
+
+// mark every seated player as disconnected
+func resetConnections(players [4]string, disconnected *[4]bool) {
+	for i, p := range players {
+		disconnected[i] = p != ""
+	}
+}
+
+// record that name has connected to or disconnected from a table;
+// players get their seat marked, anyone else is added to or removed from the spectators
+func setConnected(players [4]string, disconnected *[4]bool, spectators []string, name string, connected bool) []string {
+	spectators = utils.Without(spectators, name)
+	if i := utils.IndexOf(players[:], name); i != -1 {
+		disconnected[i] = !connected
+	} else if connected {
+		spectators = append(spectators, name)
+	}
+	return spectators
+}
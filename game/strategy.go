@@ -0,0 +1,236 @@
+package game
+
+import (
+	"sort"
+	"time"
+
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+const DEFAULT_STRATEGY = "easy"
+
+// what a bot in seat is allowed to know while bidding
+type BidView struct {
+	Seat   int     `json:"seat"`
+	Hand   []Card  `json:"hand"`
+	Passed [4]bool `json:"passed"`
+	Bid    int     `json:"bid"` // highest bid so far, or 0
+	// seat that made the highest bid, or -1
+	HighBidder int   `json:"highBidder"`
+	Rules      Rules `json:"rules"`
+}
+
+// what a bot that won the bid knows when choosing trump and exchanging with the widow
+type WidowView struct {
+	Seat  int    `json:"seat"`
+	Hand  []Card `json:"hand"`
+	Widow []Card `json:"widow"`
+	Bid   int    `json:"bid"`
+	Rules Rules  `json:"rules"`
+}
+
+// what a bot in seat is allowed to know while playing
+type PlayView struct {
+	Seat      int     `json:"seat"`
+	Hand      []Card  `json:"hand"`
+	Table     []Card  `json:"table"`
+	Leader    int     `json:"leader"` // seat that led the current trick
+	Tricks    []Trick `json:"tricks"`
+	Trump     Color   `json:"trump"`
+	Bid       int     `json:"bid"`
+	BidWinner int     `json:"bidWinner"`
+	Widow     []Card  `json:"widow"` // only known to the bid winner
+	Legal     []Card  `json:"legal"`
+	Rules     Rules   `json:"rules"`
+}
+
+// decision making for a bot occupying an empty seat
+type Strategy interface {
+	// amount to bid; anything not allowed by the rules (e.g. 0) is a pass
+	Bid(view BidView) int
+	ChooseTrump(view WidowView) Color
+	// cards to give to and take from the widow, which must be the same length
+	ExchangeWidow(view WidowView, trump Color) ([]Card, []Card)
+	// must return one of view.Legal
+	PlayCard(view PlayView) Card
+}
+
+var strategies = map[string]Strategy{
+	"easy":   EasyStrategy{},
+	"medium": MediumStrategy{},
+	"hard":   HardStrategy{},
+	"expert": ISMCTSStrategy{
+		Iterations:  2000,
+		MaxDuration: 750 * time.Millisecond,
+	},
+}
+
+// finds strategies that aren't built in, e.g. external bots registered with the server
+var externalStrategies func(name string) (Strategy, bool)
+
+// let the server supply strategies the game doesn't know about; built-in names take priority
+func SetExternalStrategies(lookup func(name string) (Strategy, bool)) {
+	externalStrategies = lookup
+}
+
+// look up a strategy by name, falling back to the default strategy for unknown names
+func GetStrategy(name string) Strategy {
+	if strategy, ok := strategies[name]; ok {
+		return strategy
+	}
+	if externalStrategies != nil {
+		if strategy, ok := externalStrategies(name); ok {
+			return strategy
+		}
+	}
+	return strategies[DEFAULT_STRATEGY]
+}
+
+// whether name is a built-in strategy; external strategies are checked by whoever supplies them
+func IsStrategy(name string) bool {
+	_, ok := strategies[name]
+	return ok || name == ""
+}
+
+func StrategyNames() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// seat and card currently winning a (possibly incomplete) trick
+func trickWinner(table []Card, leader int, trump Color, rules Rules) (int, Card) {
+	winner := leader
+	best := table[0]
+	for i := 1; i < len(table); i++ {
+		if rules.Beats(table[i], best, trump) {
+			winner = (leader + i) % 4
+			best = table[i]
+		}
+	}
+	return winner, best
+}
+
+func partner(seat int) int {
+	return (seat + 2) % 4
+}
+
+func points(cards []Card, rules Rules) int {
+	total := 0
+	for _, card := range cards {
+		total += rules.CardPoints(card)
+	}
+	return total
+}
+
+// all cards this seat has seen leave a hand: completed tricks plus the current table
+func (v PlayView) played() []Card {
+	cards := append([]Card{}, v.Table...)
+	for _, trick := range v.Tricks {
+		cards = append(cards, trick.Cards...)
+	}
+	return cards
+}
+
+// cards that could still be in another player's hand (or in the widow, if this seat didn't set it)
+func (v PlayView) unseen() []Card {
+	known := append(v.played(), v.Hand...)
+	known = append(known, v.Widow...)
+	unseen := []Card{}
+	for _, card := range v.Rules.Deck() {
+		if !utils.Contains(known, card) {
+			unseen = append(unseen, card)
+		}
+	}
+	return unseen
+}
+
+// colors each seat has shown it is out of, by failing to follow the led color
+func (v PlayView) voids() [4]map[Color]bool {
+	voids := [4]map[Color]bool{}
+	for i := range voids {
+		voids[i] = make(map[Color]bool)
+	}
+	check := func(cards []Card, leader int) {
+		if len(cards) == 0 {
+			return
+		}
+		led := cards[0].EffectiveColor(v.Trump)
+		for i := 1; i < len(cards); i++ {
+			if cards[i].EffectiveColor(v.Trump) != led {
+				voids[(leader+i)%4][led] = true
+			}
+		}
+	}
+	for _, trick := range v.Tricks {
+		check(trick.Cards, trick.Leader)
+	}
+	check(v.Table, v.Leader)
+	return voids
+}
+
+// whether no unseen card of the same color can beat card
+func (v PlayView) isBoss(card Card, unseen []Card) bool {
+	color := card.EffectiveColor(v.Trump)
+	for _, other := range unseen {
+		if other.EffectiveColor(v.Trump) == color && v.Rules.Beats(other, card, v.Trump) {
+			return false
+		}
+	}
+	return true
+}
+
+// sort cards from weakest to strongest
+func (v PlayView) sortByStrength(cards []Card) []Card {
+	sorted := append([]Card{}, cards...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		trumpI := sorted[i].EffectiveColor(v.Trump) == v.Trump
+		trumpJ := sorted[j].EffectiveColor(v.Trump) == v.Trump
+		if trumpI != trumpJ {
+			return trumpJ
+		}
+		return v.Rules.rank(sorted[i]) < v.Rules.rank(sorted[j])
+	})
+	return sorted
+}
+
+// the cheapest card to throw away: fewest points, then weakest
+func (v PlayView) cheapest(cards []Card) Card {
+	sorted := v.sortByStrength(cards)
+	best := sorted[0]
+	for _, card := range sorted {
+		if v.Rules.CardPoints(card) < v.Rules.CardPoints(best) {
+			best = card
+		}
+	}
+	return best
+}
+
+// the card worth the most points, preferring to give up weaker cards
+func (v PlayView) richest(cards []Card) Card {
+	sorted := v.sortByStrength(cards)
+	best := sorted[0]
+	for _, card := range sorted {
+		if v.Rules.CardPoints(card) > v.Rules.CardPoints(best) {
+			best = card
+		}
+	}
+	return best
+}
+
+// weakest card in cards that would take the lead in the current trick, if any
+func (v PlayView) cheapestWinner(cards []Card) (Card, bool) {
+	if len(v.Table) == 0 {
+		return Card{}, false
+	}
+	_, best := trickWinner(v.Table, v.Leader, v.Trump, v.Rules)
+	for _, card := range v.sortByStrength(cards) {
+		if v.Rules.Beats(card, best, v.Trump) {
+			return card, true
+		}
+	}
+	return Card{}, false
+}
@@ -0,0 +1,141 @@
+package game
+
+import (
+	"sort"
+
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// simple heuristics: bid on raw card values, follow suit high, and trump in whenever possible
+type EasyStrategy struct{}
+
+func (s EasyStrategy) Bid(view BidView) int {
+	value := handValue(view.Hand)
+	// round up to the next allowed bid
+	bid := value + (view.Rules.BidIncrement - value%view.Rules.BidIncrement)
+	if bid > view.Rules.MaxBid {
+		bid = view.Rules.MaxBid
+	}
+	return bid
+}
+
+func (s EasyStrategy) ChooseTrump(view WidowView) Color {
+	return chooseAITrump(append(append([]Card{}, view.Hand...), view.Widow...))
+}
+
+func (s EasyStrategy) ExchangeWidow(view WidowView, trump Color) ([]Card, []Card) {
+	return chooseAIWidowExchange(view.Hand, view.Widow, trump, view.Rules)
+}
+
+func (s EasyStrategy) PlayCard(view PlayView) Card {
+	moves := view.Legal
+	chosen := moves[len(moves)-1]
+	led := Color(0)
+	if len(view.Table) > 0 {
+		led = view.Table[0].EffectiveColor(view.Trump)
+	}
+	if led != Color(0) && chosen.EffectiveColor(view.Trump) != led {
+		// can't follow suit, so trump in if possible
+		for _, card := range moves {
+			if card.EffectiveColor(view.Trump) == view.Trump {
+				chosen = card
+			}
+		}
+	}
+	return chosen
+}
+
+func handValue(h []Card) int {
+	total := 0
+	colorCounts := make(map[Color]int)
+	colorCounts[Red] = 0
+	colorCounts[Yellow] = 0
+	colorCounts[Green] = 0
+	colorCounts[Black] = 0
+	for _, card := range h {
+		if card.Value == 1 {
+			total += 15
+		} else if card.Value == 0 {
+			colorCounts[Red]++
+			colorCounts[Yellow]++
+			colorCounts[Green]++
+			colorCounts[Black]++
+		} else {
+			total += card.Value
+			colorCounts[card.Color]++
+		}
+	}
+	maxColorCount := 0
+	for _, count := range colorCounts {
+		if count > maxColorCount {
+			maxColorCount = count
+		}
+	}
+	total += maxColorCount * 5
+	return total
+}
+
+// pick the color with the most and strongest cards
+func chooseAITrump(cards []Card) Color {
+	strength := make(map[Color]int)
+	for _, card := range cards {
+		if card == Bird {
+			continue
+		}
+		value := card.Value
+		if value == 1 {
+			value = 15
+		}
+		strength[card.Color] += 10 + value
+	}
+	best := Red
+	for color := Red; color <= Black; color++ {
+		if strength[color] > strength[best] {
+			best = color
+		}
+	}
+	return best
+}
+
+// how much the AI wants to hold on to a card after choosing trump
+func aiKeepValue(card Card, trump Color, rules Rules) int {
+	if card.EffectiveColor(trump) == trump {
+		return 100 + rules.rank(card)
+	}
+	if card.Value == 1 {
+		return 80
+	}
+	if points := rules.CardPoints(card); points > 0 {
+		return 50 + points
+	}
+	return card.Value
+}
+
+// keep trump, counters and high cards; send weak off-color cards to the widow
+func chooseAIWidowExchange(hand []Card, widow []Card, trump Color, rules Rules) ([]Card, []Card) {
+	return exchangeByValue(hand, widow, func(card Card) int {
+		return aiKeepValue(card, trump, rules)
+	})
+}
+
+// keep the len(hand) cards with the highest keep values
+func exchangeByValue(hand []Card, widow []Card, keepValue func(Card) int) ([]Card, []Card) {
+	combined := append(append([]Card{}, hand...), widow...)
+	sort.SliceStable(combined, func(i, j int) bool {
+		return keepValue(combined[i]) > keepValue(combined[j])
+	})
+	keep := combined[:len(hand)]
+	toWidow := []Card{}
+	for _, card := range hand {
+		if !utils.Contains(keep, card) {
+			toWidow = append(toWidow, card)
+		}
+	}
+	fromWidow := []Card{}
+	for _, card := range widow {
+		if utils.Contains(keep, card) {
+			fromWidow = append(fromWidow, card)
+		}
+	}
+	return toWidow, fromWidow
+}
@@ -0,0 +1,52 @@
+package game
+
+// medium strategy plus tracking of which colors each player is out of, more aggressive bidding,
+// and a widow exchange that buries vulnerable counters when the widow is safe
+type HardStrategy struct{}
+
+func (s HardStrategy) Bid(view BidView) int {
+	// winning the auction is worth the risk of occasionally coming up a little short
+	estimate := estimateHand(view.Hand, view.Rules) + 10
+	if !view.Rules.WidowToLastTrick {
+		// the widow's points go to whoever wins the bid
+		estimate += 10
+	}
+	return stepBid(view, estimate, 30)
+}
+
+func (s HardStrategy) ChooseTrump(view WidowView) Color {
+	return mediumTrump(append(append([]Card{}, view.Hand...), view.Widow...), view.Rules)
+}
+
+func (s HardStrategy) ExchangeWidow(view WidowView, trump Color) ([]Card, []Card) {
+	combined := append(append([]Card{}, view.Hand...), view.Widow...)
+	counts := colorCounts(combined, trump)
+	aces := make(map[Color]bool)
+	for _, card := range combined {
+		if card.Value == 1 {
+			aces[card.Color] = true
+		}
+	}
+	// if the widow goes to the bidding team, it's the safest place for an unprotected counter
+	buryCounters := !view.Rules.WidowToLastTrick
+	return exchangeByValue(view.Hand, view.Widow, func(card Card) int {
+		if card.EffectiveColor(trump) == trump {
+			return 100 + view.Rules.rank(card)
+		}
+		if card.Value == 1 {
+			return 80
+		}
+		points := view.Rules.CardPoints(card)
+		if points > 0 {
+			if buryCounters && !aces[card.Color] {
+				return -points
+			}
+			return 50 + points
+		}
+		return card.Value + 2*counts[card.Color]
+	})
+}
+
+func (s HardStrategy) PlayCard(view PlayView) Card {
+	return playCounting(view, true)
+}
@@ -0,0 +1,259 @@
+package game
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// information-set Monte Carlo tree search over card play
+//
+// each iteration deals the cards this seat can't see in a way that's consistent with what it has
+// observed (colors other players have shown they're out of, and the widow if this seat set it),
+// then walks a single shared tree using the real PlayCard/FinishPlay rules on that deal.
+// bidding and the widow exchange are delegated to the hard strategy.
+//
+// with a nonzero Seed and no MaxDuration, the chosen card depends only on the view,
+// so results can be reproduced offline
+type ISMCTSStrategy struct {
+	Iterations  int           // number of determinized playouts per move
+	MaxDuration time.Duration // stop early after this long; 0 for no limit
+	Seed        int64         // 0 seeds from the clock
+	Exploration float64       // UCB exploration constant; 0 uses the default
+}
+
+const DEFAULT_ISMCTS_EXPLORATION = 0.7
+
+func (s ISMCTSStrategy) Bid(view BidView) int {
+	return HardStrategy{}.Bid(view)
+}
+
+func (s ISMCTSStrategy) ChooseTrump(view WidowView) Color {
+	return HardStrategy{}.ChooseTrump(view)
+}
+
+func (s ISMCTSStrategy) ExchangeWidow(view WidowView, trump Color) ([]Card, []Card) {
+	return HardStrategy{}.ExchangeWidow(view, trump)
+}
+
+type ismctsNode struct {
+	move     Card
+	player   int // seat that played move to reach this node
+	parent   *ismctsNode
+	children []*ismctsNode
+	visits   int
+	avail    int
+	reward   float64
+}
+
+func (n *ismctsNode) child(move Card) *ismctsNode {
+	for _, c := range n.children {
+		if c.move == move {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s ISMCTSStrategy) PlayCard(view PlayView) Card {
+	if len(view.Legal) == 1 {
+		return view.Legal[0]
+	}
+	rng := rand.New(rand.NewSource(s.seedFor(view)))
+	exploration := s.Exploration
+	if exploration == 0 {
+		exploration = DEFAULT_ISMCTS_EXPLORATION
+	}
+	var deadline time.Time
+	if s.MaxDuration > 0 {
+		deadline = time.Now().Add(s.MaxDuration)
+	}
+	root := &ismctsNode{player: -1}
+	for i := 0; i < s.Iterations; i++ {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+		g := determinize(view, rng)
+		node := root
+		// selection and expansion
+		for !g.Done {
+			seat := g.CurrentPlayer
+			legal := g.LegalMoves(seat)
+			untried := []Card{}
+			for _, move := range legal {
+				if c := node.child(move); c != nil {
+					c.avail++
+				} else {
+					untried = append(untried, move)
+				}
+			}
+			if len(untried) > 0 {
+				move := untried[rng.Intn(len(untried))]
+				child := &ismctsNode{move: move, player: seat, parent: node, avail: 1}
+				node.children = append(node.children, child)
+				node = child
+				simulateMove(&g, seat, move)
+				break
+			}
+			var best *ismctsNode
+			bestScore := math.Inf(-1)
+			for _, move := range legal {
+				c := node.child(move)
+				score := c.reward/float64(c.visits) + exploration*math.Sqrt(math.Log(float64(c.avail))/float64(c.visits))
+				if score > bestScore {
+					best, bestScore = c, score
+				}
+			}
+			node = best
+			simulateMove(&g, seat, node.move)
+		}
+		// random playout
+		for !g.Done {
+			legal := g.LegalMoves(g.CurrentPlayer)
+			simulateMove(&g, g.CurrentPlayer, legal[rng.Intn(len(legal))])
+		}
+		result, _ := g.Score()
+		for ; node != nil; node = node.parent {
+			node.visits++
+			if node.player >= 0 {
+				node.reward += teamReward(result, node.player%2, view.Rules)
+			}
+		}
+	}
+	var best *ismctsNode
+	for _, c := range root.children {
+		if utils.Contains(view.Legal, c.move) && (best == nil || c.visits > best.visits) {
+			best = c
+		}
+	}
+	if best == nil {
+		return HardStrategy{}.PlayCard(view)
+	}
+	return best.move
+}
+
+// score margin for team, scaled to [0, 1]
+func teamReward(result HandResult, team int, rules Rules) float64 {
+	scale := float64(2 * (rules.DeckPoints() + rules.MostCardsBonus + rules.LastTrickBonus + rules.MaxBid))
+	margin := float64(result.Scores[team] - result.Scores[1-team])
+	return 0.5 + margin/scale
+}
+
+func simulateMove(g *GameState, seat int, card Card) {
+	g.PlayCard(seat, card)
+	if len(g.Table) == 4 {
+		g.FinishPlay()
+	}
+}
+
+func (s ISMCTSStrategy) seedFor(view PlayView) int64 {
+	if s.Seed == 0 {
+		return time.Now().UnixNano()
+	}
+	seed := s.Seed*31 + int64(view.Seat)
+	for _, cards := range [][]Card{view.Hand, view.played()} {
+		for _, card := range cards {
+			seed = seed*31 + int64(card.Color)*16 + int64(card.Value)
+		}
+	}
+	return seed
+}
+
+// number of attempts at dealing hidden cards consistent with known voids before giving up on them
+const DETERMINIZE_ATTEMPTS = 20
+
+// build a full game state from a view by dealing out the cards this seat can't see
+func determinize(view PlayView, rng *rand.Rand) GameState {
+	handSize := (len(view.Rules.Deck()) - view.Rules.WidowSize) / 4
+	need := [5]int{handSize, handSize, handSize, handSize} // cards needed by each seat; index 4 is the widow
+	for _, trick := range view.Tricks {
+		for i := range trick.Cards {
+			need[(trick.Leader+i)%4]--
+		}
+	}
+	for i := range view.Table {
+		need[(view.Leader+i)%4]--
+	}
+	need[view.Seat] = 0
+	if view.Seat != view.BidWinner {
+		need[4] = view.Rules.WidowSize
+	}
+
+	unseen := view.unseen()
+	voids := view.voids()
+	hidden, ok := [5][]Card{}, false
+	for attempt := 0; attempt < DETERMINIZE_ATTEMPTS && !ok; attempt++ {
+		hidden, ok = dealHidden(unseen, need, voids, view.Trump, rng, true)
+	}
+	if !ok {
+		hidden, _ = dealHidden(unseen, need, voids, view.Trump, rng, false)
+	}
+
+	g := GameState{
+		Table:         append([]Card{}, view.Table...),
+		Tricks:        append([]Trick{}, view.Tricks...),
+		CurrentPlayer: view.Seat,
+		LastWinner:    view.Leader,
+		Trump:         view.Trump,
+		Bid:           view.Bid,
+		BidWinner:     view.BidWinner,
+		Rules:         view.Rules,
+	}
+	for seat := 0; seat < 4; seat++ {
+		if seat == view.Seat {
+			g.Hands[seat] = append([]Card{}, view.Hand...)
+		} else {
+			g.Hands[seat] = hidden[seat]
+		}
+	}
+	if view.Seat == view.BidWinner {
+		g.Widow = append([]Card{}, view.Widow...)
+	} else {
+		g.Widow = hidden[4]
+	}
+	for _, trick := range view.Tricks {
+		team := trick.Winner % 2
+		g.Discarded[team] = append(g.Discarded[team], trick.Cards...)
+	}
+	return g
+}
+
+// randomly split cards into buckets of the sizes in need
+// if respectVoids is set, no seat gets a card of a color it's known to be out of,
+// and ok is false if the random deal painted itself into a corner
+func dealHidden(cards []Card, need [5]int, voids [4]map[Color]bool, trump Color, rng *rand.Rand, respectVoids bool) ([5][]Card, bool) {
+	var buckets [5][]Card
+	shuffled := append([]Card{}, cards...)
+	rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	for _, card := range shuffled {
+		color := card.EffectiveColor(trump)
+		options := []int{}
+		weights := 0
+		for b := range buckets {
+			open := need[b] - len(buckets[b])
+			if open <= 0 {
+				continue
+			}
+			if respectVoids && b < 4 && voids[b][color] {
+				continue
+			}
+			options = append(options, b)
+			weights += open
+		}
+		if len(options) == 0 {
+			return buckets, false
+		}
+		// weight by open space so that small buckets don't fill up first
+		pick := rng.Intn(weights)
+		for _, b := range options {
+			pick -= need[b] - len(buckets[b])
+			if pick < 0 {
+				buckets[b] = append(buckets[b], card)
+				break
+			}
+		}
+	}
+	return buckets, true
+}
@@ -0,0 +1,125 @@
+package game
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/quevivasbien/bird-game/utils"
+)
+
+// a hand with a reproducible deal, with seat 0 having won the bid and named red as trump,
+// played forward by tricks tricks of everyone playing their first legal card
+func seededGame(seed int64, tricks int) GameState {
+	rules := DefaultRules()
+	deck := rules.Deck()
+	rand.New(rand.NewSource(seed)).Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+	g := GameState{
+		Players: [4]string{"a", "b", "c", "d"},
+		Widow:   deck[:rules.WidowSize],
+		Table:   []Card{},
+		Tricks:  []Trick{},
+		Trump:   Red,
+		Bid:     120,
+		Rules:   rules,
+	}
+	handSize := (len(deck) - rules.WidowSize) / 4
+	for seat := range g.Hands {
+		start := rules.WidowSize + seat*handSize
+		g.Hands[seat] = append([]Card{}, deck[start:start+handSize]...)
+	}
+	for i := 0; i < 4*tricks; i++ {
+		simulateMove(&g, g.CurrentPlayer, g.LegalMoves(g.CurrentPlayer)[0])
+	}
+	return g
+}
+
+func TestISMCTSSameSeedSameCard(t *testing.T) {
+	for _, tricks := range []int{0, 3, 6} {
+		g := seededGame(7, tricks)
+		// put a card on the table so that the seat has to think about following
+		simulateMove(&g, g.CurrentPlayer, g.LegalMoves(g.CurrentPlayer)[0])
+		view := g.playView(g.CurrentPlayer)
+		s := ISMCTSStrategy{Iterations: 300, Seed: 99}
+		first := s.PlayCard(view)
+		if !utils.Contains(view.Legal, first) {
+			t.Fatalf("after %d tricks, chose %v, which is not one of %v", tricks, first, view.Legal)
+		}
+		for i := 0; i < 3; i++ {
+			if card := s.PlayCard(view); card != first {
+				t.Fatalf("after %d tricks, chose %v and then %v with the same seed", tricks, first, card)
+			}
+		}
+	}
+}
+
+// check the hidden cards in a deal for view are consistent with what view's seat knows
+func checkDeterminized(t *testing.T, view PlayView, g GameState) {
+	t.Helper()
+	seen := map[Card]bool{}
+	count := func(cards []Card) {
+		for _, card := range cards {
+			if seen[card] {
+				t.Fatalf("%v was dealt twice", card)
+			}
+			seen[card] = true
+		}
+	}
+	for _, hand := range g.Hands {
+		count(hand)
+	}
+	count(g.Widow)
+	count(view.played())
+	if len(seen) != len(view.Rules.Deck()) {
+		t.Fatalf("deal accounts for %d cards, not the whole deck of %d", len(seen), len(view.Rules.Deck()))
+	}
+	if !reflect.DeepEqual(g.Hands[view.Seat], view.Hand) {
+		t.Fatalf("own hand changed from %v to %v", view.Hand, g.Hands[view.Seat])
+	}
+	if len(g.Widow) != view.Rules.WidowSize {
+		t.Fatalf("widow has %d cards, not %d", len(g.Widow), view.Rules.WidowSize)
+	}
+	if view.Seat == view.BidWinner && !reflect.DeepEqual(g.Widow, view.Widow) {
+		t.Fatalf("bid winner set the widow to %v, but the deal has %v", view.Widow, g.Widow)
+	}
+	voids := view.voids()
+	for seat, hand := range g.Hands {
+		for _, card := range hand {
+			if voids[seat][card.EffectiveColor(view.Trump)] {
+				t.Fatalf("seat %d is known to be out of %v but was dealt %v", seat, card.EffectiveColor(view.Trump), card)
+			}
+		}
+	}
+	// everyone has played one card per finished trick, plus one if they've played to this trick
+	handSize := (len(view.Rules.Deck()) - view.Rules.WidowSize) / 4
+	for seat, hand := range g.Hands {
+		want := handSize - len(view.Tricks)
+		for i := range view.Table {
+			if (view.Leader+i)%4 == seat {
+				want--
+			}
+		}
+		if len(hand) != want {
+			t.Fatalf("seat %d was dealt %d cards, expected %d", seat, len(hand), want)
+		}
+	}
+}
+
+func TestDeterminizeRespectsVoidsAndWidow(t *testing.T) {
+	g := seededGame(2, 6)
+	simulateMove(&g, g.CurrentPlayer, g.LegalMoves(g.CurrentPlayer)[0])
+	hasVoid := false
+	for _, seatVoids := range g.playView(0).voids() {
+		hasVoid = hasVoid || len(seatVoids) > 0
+	}
+	if !hasVoid {
+		t.Fatal("test position should have a seat that has shown a void")
+	}
+	rng := rand.New(rand.NewSource(1))
+	for seat := 0; seat < 4; seat++ {
+		view := g.playView(seat)
+		for i := 0; i < 50; i++ {
+			checkDeterminized(t, view, determinize(view, rng))
+		}
+	}
+}
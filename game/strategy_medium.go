@@ -0,0 +1,210 @@
+package game
+
+// counts cards to know which cards are boss, feeds points to a partner who is winning,
+// and raises the bid a step at a time instead of jumping straight to its hand value
+type MediumStrategy struct{}
+
+func (s MediumStrategy) Bid(view BidView) int {
+	return stepBid(view, estimateHand(view.Hand, view.Rules), 20)
+}
+
+// bid the smallest allowed amount if it's within our estimate;
+// don't compete with a partner unless our hand is clearly better than their bid
+func stepBid(view BidView, estimate int, partnerMargin int) int {
+	if view.HighBidder == partner(view.Seat) && estimate < view.Bid+partnerMargin {
+		return 0
+	}
+	next := view.Rules.MinBid
+	if view.Bid != 0 {
+		next = view.Bid + view.Rules.BidIncrement
+	}
+	if next > estimate {
+		return 0
+	}
+	return next
+}
+
+// rough guess of how many points a hand can take, assuming its best color becomes trump
+func estimateHand(hand []Card, rules Rules) int {
+	trump := mediumTrump(hand, rules)
+	trumpCount := 0
+	total := 0
+	for _, card := range hand {
+		if card.EffectiveColor(trump) == trump {
+			trumpCount++
+			total += 4 + rules.rank(card)/3
+		} else if card.Value == 1 {
+			total += 15
+		} else if card.Value >= 13 {
+			total += 5
+		}
+	}
+	// long trump takes over the hand late
+	total += 6 * trumpCount
+	// scale to the points available under these rules (tuned for a 200 point deck)
+	return total * (rules.DeckPoints() + rules.MostCardsBonus + rules.LastTrickBonus) / 200
+}
+
+// color with the most cards, breaking ties by strength
+func mediumTrump(cards []Card, rules Rules) Color {
+	strength := make(map[Color]int)
+	for _, card := range cards {
+		if card == Bird {
+			continue
+		}
+		strength[card.Color] += 12 + rules.rank(card)/2
+	}
+	best := Red
+	for color := Red; color <= Black; color++ {
+		if strength[color] > strength[best] {
+			best = color
+		}
+	}
+	return best
+}
+
+func (s MediumStrategy) ChooseTrump(view WidowView) Color {
+	return mediumTrump(append(append([]Card{}, view.Hand...), view.Widow...), view.Rules)
+}
+
+// like the easy exchange, but prefers emptying short colors so we can trump them later
+func (s MediumStrategy) ExchangeWidow(view WidowView, trump Color) ([]Card, []Card) {
+	combined := append(append([]Card{}, view.Hand...), view.Widow...)
+	counts := colorCounts(combined, trump)
+	return exchangeByValue(view.Hand, view.Widow, func(card Card) int {
+		value := aiKeepValue(card, trump, view.Rules)
+		if value < 50 {
+			value += 2 * counts[card.Color]
+		}
+		return value
+	})
+}
+
+func colorCounts(cards []Card, trump Color) map[Color]int {
+	counts := make(map[Color]int)
+	for _, card := range cards {
+		counts[card.EffectiveColor(trump)]++
+	}
+	return counts
+}
+
+func (s MediumStrategy) PlayCard(view PlayView) Card {
+	return playCounting(view, false)
+}
+
+// shared play logic for the medium and hard strategies
+// if useVoids is set, also consider which players have shown they are out of a color
+func playCounting(view PlayView, useVoids bool) Card {
+	legal := view.Legal
+	if len(legal) == 1 {
+		return legal[0]
+	}
+	unseen := view.unseen()
+	var voids [4]map[Color]bool
+	if useVoids {
+		voids = view.voids()
+	}
+	if len(view.Table) == 0 {
+		return leadCard(view, unseen, voids)
+	}
+	winner, best := trickWinner(view.Table, view.Leader, view.Trump, view.Rules)
+	if winner == partner(view.Seat) && view.holds(best, len(view.Table)+1, unseen, voids) {
+		// partner is taking this one, so give them points
+		return view.richest(legal)
+	}
+	if card, ok := view.cheapestWinner(legal); ok {
+		if points(view.Table, view.Rules) > 0 || view.holds(card, len(view.Table)+1, unseen, voids) {
+			return card
+		}
+	}
+	return view.cheapest(legal)
+}
+
+// whether card would still be winning after the players in trick positions from..3 play
+// without voids, only checks for higher cards of the same color
+func (v PlayView) holds(card Card, from int, unseen []Card, voids [4]map[Color]bool) bool {
+	if from > 3 {
+		return true
+	}
+	if voids[0] == nil {
+		return v.isBoss(card, unseen)
+	}
+	led := v.Table[0].EffectiveColor(v.Trump)
+	for i := from; i <= 3; i++ {
+		seat := (v.Leader + i) % 4
+		if seat == v.Seat {
+			continue
+		}
+		for _, other := range unseen {
+			color := other.EffectiveColor(v.Trump)
+			if voids[seat][color] {
+				continue
+			}
+			// a player can only play off the led color if they're out of it
+			if color != led && !voids[seat][led] {
+				continue
+			}
+			if v.Rules.Beats(other, card, v.Trump) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func leadCard(view PlayView, unseen []Card, voids [4]map[Color]bool) Card {
+	legal := view.Legal
+	opponentsHaveTrump := false
+	for _, card := range unseen {
+		if card.EffectiveColor(view.Trump) == view.Trump {
+			opponentsHaveTrump = true
+			break
+		}
+	}
+	var trumpBoss, offBoss *Card
+	for i, card := range legal {
+		if !view.isBoss(card, unseen) {
+			continue
+		}
+		if card.EffectiveColor(view.Trump) == view.Trump {
+			trumpBoss = &legal[i]
+		} else if offBoss == nil || view.Rules.CardPoints(card) > view.Rules.CardPoints(*offBoss) {
+			if voids[0] == nil || !opponentVoid(view, voids, card.Color) {
+				offBoss = &legal[i]
+			}
+		}
+	}
+	// the bidding team wants to pull trump early so its counters are safe
+	if view.BidWinner%2 == view.Seat%2 && trumpBoss != nil && opponentsHaveTrump {
+		return *trumpBoss
+	}
+	if offBoss != nil {
+		return *offBoss
+	}
+	// otherwise lead something cheap, ideally a color partner can trump
+	offColor := []Card{}
+	for _, card := range legal {
+		if card.EffectiveColor(view.Trump) != view.Trump {
+			if voids[0] != nil && voids[partner(view.Seat)][card.Color] && !voids[partner(view.Seat)][view.Trump] {
+				return card
+			}
+			if voids[0] == nil || !opponentVoid(view, voids, card.Color) {
+				offColor = append(offColor, card)
+			}
+		}
+	}
+	if len(offColor) > 0 {
+		return view.cheapest(offColor)
+	}
+	return view.cheapest(legal)
+}
+
+// whether an opponent is out of color and might trump it
+func opponentVoid(view PlayView, voids [4]map[Color]bool, color Color) bool {
+	for _, seat := range []int{(view.Seat + 1) % 4, (view.Seat + 3) % 4} {
+		if voids[seat][color] && !voids[seat][view.Trump] {
+			return true
+		}
+	}
+	return false
+}
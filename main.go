@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -12,11 +15,14 @@ import (
 	"github.com/quevivasbien/bird-game/template"
 )
 
-const AWS_REGION = "us-east-1"
 const PORT = ":3000"
 
 func main() {
-	app := fiber.New(fiber.Config{Immutable: true})
+	app := fiber.New(fiber.Config{
+		Immutable: true,
+		// behind a proxy, e.g. Fly-Client-IP on fly.io, so rate limits see the real client IP
+		ProxyHeader: os.Getenv("BIRD_PROXY_HEADER"),
+	})
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
 		AllowHeaders:     "*",
@@ -26,11 +32,14 @@ func main() {
 		Format: "[${ip}]:${port} ${status} - ${method} ${path}\n",
 	}))
 
-	tables, err := db.GetTables(AWS_REGION)
+	// set BIRD_STORAGE=bolt to keep everything in a local file instead of on dynamodb
+	config := db.StorageConfigFromEnv()
+	storage, err := db.OpenStorage(config)
 	if err != nil {
-		fmt.Printf("When initializing database, got error:\n%v\n\nOnly test user will be available.", err)
+		panic(fmt.Sprintf("Error opening %s storage: %v", config.Backend, err))
 	}
-	err = api.InitApi(app.Group("/api"), tables)
+	defer storage.Close()
+	err = api.InitApi(app.Group("/api"), storage)
 	if err != nil {
 		panic(fmt.Sprintf("Error initializing API router: %v", err))
 	}
@@ -44,7 +53,16 @@ func main() {
 		}),
 	)
 
+	// save live games before exiting, so they can be picked up again after a deploy
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		app.Shutdown()
+	}()
+
 	if err := app.Listen(PORT); err != nil {
 		panic(err)
 	}
+	api.FlushSnapshots()
 }
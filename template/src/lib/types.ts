@@ -1,14 +1,39 @@
 export interface UserInfo {
     name: string;
     admin: boolean;
+    guest: boolean;
     expireTime: number;
 }
 
+export interface Rules {
+    minBid: number;
+    bidIncrement: number;
+    maxBid: number;
+    birdRank: number;
+    birdPoints: number;
+    widowSize: number;
+    widowToLastTrick: boolean;
+    lowCardsRemoved: number;
+    mostCardsBonus: number;
+    lastTrickBonus: number;
+}
+
+export interface SpectatorSettings {
+    allowed: boolean;
+    kibitz: boolean;
+    kibitzDelay: number;
+}
+
 export interface LobbyInfo {
     id: string;
     host: string;
     players: string[];
     started: boolean;
+    rules: Rules;
+    bots: string[];
+    disconnected: boolean[];
+    spectating: SpectatorSettings;
+    spectators: string[];
 }
 
 export interface Card {
@@ -24,6 +49,10 @@ export interface BidInfo {
     passed: boolean[];
     currentBidder: number;
     bid: number;
+    rules: Rules;
+    disconnected: boolean[];
+    spectators: string[];
+    hands?: Card[][];
 }
 
 export interface GameInfo {
@@ -38,4 +67,18 @@ export interface GameInfo {
     trump: number;
     bid: number;
     bidWinner: number;
+    rules: Rules;
+    disconnected: boolean[];
+    spectators: string[];
+    hands?: Card[][];
+}
+
+export interface HandResult {
+    cardPoints: number[];
+    bonus: number[];
+    points: number[];
+    scores: number[];
+    bidTeam: number;
+    bid: number;
+    made: boolean;
 }
@@ -23,7 +23,36 @@ export function load(event: LoadEvent) {
         return [response.ok, response.status];
     };
 
+    // end every session for this user, on all devices
+    const logoutEverywhere = async () => {
+        const response = await event.fetch(
+            base + "/api/auth/logout/all",
+            {
+                method: "POST",
+            },
+        );
+        if (response.ok) {
+            userStore.set(undefined);
+        }
+        return [response.ok, response.status];
+    };
+
+    // swap the refresh token cookie for a new access token
+    const refresh = async () => {
+        const response = await event.fetch(
+            base + "/api/auth/refresh",
+            {
+                method: "POST",
+            },
+        );
+        if (!response.ok) {
+            return;
+        }
+        return await response.json();
+    };
+
     // if a jwt cookie is present, use it to get info for userStore
+    // otherwise, try to get a new one with the refresh token
     const syncAuth = async () => {
         const response = await event.fetch(
             base + "/api/auth/status",
@@ -31,22 +60,22 @@ export function load(event: LoadEvent) {
                 method: "GET",
             },
         );
-        if (!response.ok) {
+        if (response.ok) {
+            const userInfo = await response.json();
+            // if userInfo is unexpired, use it
+            if (Date.now() / 1000 < userInfo.expireTime) {
+                return userInfo;
+            }
+        } else {
             console.log("Problem when attempting to fetch user info:", response.statusText);
-            return;
         }
-        const userInfo = await response.json();
-        console.log(userInfo);
-        // if userInfo is unexpired, use it
-        if (Date.now() / 1000 < userInfo.expireTime) {
-            return userInfo;
-        }
-    }
-   
-
+        return await refresh();
+    };
 
     return {
         logout,
+        logoutEverywhere,
+        refresh,
         syncAuth,
     };
 }
\ No newline at end of file
@@ -1,6 +1,6 @@
 import { base } from "$app/paths";
 import { gameStore } from "$lib/stores";
-import type { Card } from "$lib/types";
+import type { Card, HandResult } from "$lib/types";
 import type { LoadEvent } from "@sveltejs/kit";
 import { get } from "svelte/store";
 
@@ -53,10 +53,10 @@ export function load(event: LoadEvent) {
         return [response.ok, response.status];
     };
 
-    const getScore = async () => {
+    const getScore = async (): Promise<HandResult | undefined> => {
         const gameInfo = get(gameStore);
         if (gameInfo === undefined) {
-            return [];
+            return;
         }
         const response = await fetch(
             `${base}/api/games/${gameInfo.id}/score`,
@@ -66,10 +66,27 @@ export function load(event: LoadEvent) {
         );
         if (!response.ok) {
             console.log("Problem getting end-of-game score; status = " + response.status);
+            return;
+        }
+        return await response.json();
+    };
+
+    const getLegalMoves = async (): Promise<Card[]> => {
+        const gameInfo = get(gameStore);
+        if (gameInfo === undefined) {
             return [];
         }
-        const data = await response.json();
-        return [data.score0, data.score1];
+        const response = await fetch(
+            `${base}/api/games/${gameInfo.id}/legal`,
+            {
+                method: "GET",
+            },
+        );
+        if (!response.ok) {
+            console.log("Problem getting legal moves; status = " + response.status);
+            return [];
+        }
+        return await response.json();
     };
 
     const playCard = async (card: Card) => {
@@ -109,6 +126,7 @@ export function load(event: LoadEvent) {
         getWidow,
         startRound,
         getScore,
+        getLegalMoves,
         playCard,
         finishPlay,
     };
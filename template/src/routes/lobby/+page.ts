@@ -1,5 +1,6 @@
 import { base } from "$app/paths";
 import { bidStore, lobbyStore } from "$lib/stores";
+import type { SpectatorSettings } from "$lib/types";
 import type { LoadEvent } from "@sveltejs/kit";
 import { get } from "svelte/store";
 
@@ -33,6 +34,52 @@ export function load(event: LoadEvent) {
         return [response.ok, response.status];
     };
 
+    const setBot = async (seat: number, strategy: string) => {
+        const lobbyInfo = get(lobbyStore);
+        if (lobbyInfo === undefined) {
+            return [false, 0];
+        }
+        const response = await event.fetch(
+            `${base}/api/lobbies/${lobbyInfo.id}/bots`,
+            {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/json",
+                },
+                body: JSON.stringify({ seat, strategy }),
+            },
+        );
+        return [response.ok, response.status];
+    };
+
+    // bots registered with the server, which can take an empty seat like the built-in AIs
+    const listBots = async () => {
+        const response = await event.fetch(`${base}/api/lobbies/bots`);
+        if (!response.ok) {
+            return [];
+        }
+        const bots: { name: string, description: string }[] = await response.json();
+        return bots;
+    };
+
+    const setSpectating = async (settings: SpectatorSettings) => {
+        const lobbyInfo = get(lobbyStore);
+        if (lobbyInfo === undefined) {
+            return [false, 0];
+        }
+        const response = await event.fetch(
+            `${base}/api/lobbies/${lobbyInfo.id}/spectating`,
+            {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/json",
+                },
+                body: JSON.stringify(settings),
+            },
+        );
+        return [response.ok, response.status];
+    };
+
     const leaveLobby = async () => {
         const lobbyInfo = get(lobbyStore);
         if (lobbyInfo === undefined) {
@@ -83,6 +130,9 @@ export function load(event: LoadEvent) {
     return {
         subscribeToLobby,
         swapPlayers,
+        setBot,
+        listBots,
+        setSpectating,
         leaveLobby,
         startBidding,
         receiveBidState,
@@ -24,7 +24,30 @@ export function load(event: LoadEvent) {
         return [response.ok, response.status];
     }
     
+    const guestLogin = async () => {
+        const response = await event.fetch(
+            base + "/api/auth/guest",
+            {
+                method: "POST",
+            }
+        );
+        if (response.ok) {
+            const userInfo = await response.json();
+            userStore.set(userInfo);
+        }
+        return [response.ok, response.status];
+    }
+
+    // whether players can sign in with an external provider instead
+    const oidc: Promise<{ enabled: boolean, name?: string }> = event.fetch(base + "/api/auth/oidc")
+        .then((response) => response.ok ? response.json() : { enabled: false })
+        .catch(() => ({ enabled: false }));
+
     return {
         login,
+        guestLogin,
+        oidc,
+        // set when coming back from a failed provider sign in
+        oidcError: event.url.searchParams.get("error"),
     };
 }
\ No newline at end of file
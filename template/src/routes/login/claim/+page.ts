@@ -0,0 +1,28 @@
+import { base } from "$app/paths";
+import { userStore } from "$lib/stores";
+import type { LoadEvent } from "@sveltejs/kit";
+
+export function load(event: LoadEvent) {
+    const claim = async (password: string) => {
+        const response = await event.fetch(
+            base + "/api/auth/claim",
+            {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/json",
+                },
+                body: JSON.stringify({
+                    password,
+                }),
+            }
+        );
+        if (response.ok) {
+            const userInfo = await response.json();
+            userStore.set(userInfo);
+        }
+        return [response.ok, response.status, response.ok ? '' : await response.text()] as const;
+    }
+    return {
+        claim,
+    };
+}
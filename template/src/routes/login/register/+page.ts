@@ -16,7 +16,7 @@ export function load(event: LoadEvent) {
                 }),
             }
         );
-        return [response.ok, response.status];
+        return [response.ok, response.status, response.ok ? '' : await response.text()] as const;
     }
     return {
         register,
@@ -1,5 +1,7 @@
 package utils
 
+import "time"
+
 func Contains[T comparable](list []T, item T) bool {
 	for _, x := range list {
 		if x == item {
@@ -24,8 +26,34 @@ func Remove[T any](list []T, index int) []T {
 	return list
 }
 
+// copy of list with every occurrence of item left out
+func Without[T comparable](list []T, item T) []T {
+	out := make([]T, 0, len(list))
+	for _, x := range list {
+		if x != item {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
 type Manageable interface {
 	GetID() string
 	GetPlayers() []string
+	// playerIndex is -1 for spectators
 	Visible(playerIndex int) interface{}
 }
+
+// implemented by manageable items that show which players currently have a live connection
+type Connectable interface {
+	SetConnected(player string, connected bool)
+	// mark everyone as disconnected, e.g. after a restart
+	ResetConnections()
+}
+
+// implemented by manageable items that people other than the players may watch
+type Watchable interface {
+	AllowsSpectators() bool
+	// how long to hold back updates from spectators
+	SpectatorDelay() time.Duration
+}